@@ -2,38 +2,54 @@ package main
 
 import (
 	"crypto/x509"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+	"github.com/rtamalin/rmt-client-testing/internal/profile"
 )
 
 type CliOpts struct {
-	Action         CliAction
-	NumClients     int64
-	NumJobs        int64
-	DataStore      string
-	Product        string
-	Version        string
-	Arch           string
-	SccHost        string
-	ApiCert        string
-	PrefLang       string
-	RegCode        string
-	InstDataPath   string
-	Trace          bool
-	NoDataProfiles bool
+	Action           CliAction
+	NumClients       int64
+	NumJobs          int64
+	DataStore        string
+	Backend          string
+	Product          string
+	Version          string
+	Arch             string
+	NoClientArch     bool
+	NoClientProduct  bool
+	NoClientInstData bool
+	SccHost          string
+	ApiCert          string
+	PrefLang         string
+	RegCode          string
+	InstDataPath     string
+	Trace            bool
+	NoDataProfiles   bool
+	NoExtensions     bool
+	DriftRate        float64
+	Seed             int64
+	Ids              IdRanges
+	RegisteredOnly   bool
+	ClientTypes      string
+	Sample           SampleSpec
 
 	// derived values
 	appName     string
 	cert        *x509.Certificate
 	clientStore *clientstore.ClientStore
 	instData    string
+	selected    []clientstore.FileId
 }
 
 var cliOpt_defaults = CliOpts{
@@ -41,10 +57,12 @@ var cliOpt_defaults = CliOpts{
 	NumClients: 10,
 	NumJobs:    10,
 	DataStore:  "ClientDataStore",
+	Backend:    clientstore.BACKEND_DIR,
 	Product:    "SLES",
 	Version:    "15.7",
 	Arch:       "x86_64",
 	PrefLang:   langPreference(),
+	Seed:       time.Now().UnixNano(),
 	instData:   "<document>{}</document>",
 }
 
@@ -81,6 +99,22 @@ func int64EnvOverride(opt *int64, varName, envName string) {
 	}
 }
 
+func float64EnvOverride(opt *float64, varName, envName string) {
+	if value := os.Getenv(envName); value != "" {
+		val, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf(
+				"Failed to set %s from %s=%q: %s",
+				varName,
+				envName,
+				value,
+				err.Error(),
+			)
+		}
+		*opt = val
+	}
+}
+
 func stringEnvOverride(opt *string, _, envName string) {
 	if value := os.Getenv(envName); value != "" {
 		*opt = value
@@ -118,6 +152,16 @@ func parseCliArgs(opts *CliOpts) {
 			"Action",
 			"ACTION",
 		},
+		{
+			&opts.Ids,
+			"Ids",
+			"IDS",
+		},
+		{
+			&opts.Sample,
+			"Sample",
+			"SAMPLE",
+		},
 	}
 	for _, o := range customTypeEnvOverrides {
 		customTypeEnvOverride(o.opt, o.varName, o.envName)
@@ -138,11 +182,31 @@ func parseCliArgs(opts *CliOpts) {
 			"NumJobs",
 			"NUM_JOBS",
 		},
+		{
+			&opts.Seed,
+			"Seed",
+			"CLIENT_SEED",
+		},
 	}
 	for _, o := range int64EnvOverrides {
 		int64EnvOverride(o.opt, o.varName, o.envName)
 	}
 
+	float64EnvOverrides := []struct {
+		opt     *float64
+		varName string
+		envName string
+	}{
+		{
+			&opts.DriftRate,
+			"DriftRate",
+			"DRIFT_RATE",
+		},
+	}
+	for _, o := range float64EnvOverrides {
+		float64EnvOverride(o.opt, o.varName, o.envName)
+	}
+
 	stringEnvOverrides := []struct {
 		opt     *string
 		varName string
@@ -153,6 +217,11 @@ func parseCliArgs(opts *CliOpts) {
 			"DataStore",
 			"DATASTORE",
 		},
+		{
+			&opts.Backend,
+			"Backend",
+			"BACKEND",
+		},
 		{
 			&opts.Product,
 			"Product",
@@ -193,6 +262,11 @@ func parseCliArgs(opts *CliOpts) {
 			"InstanceData",
 			"INST_DATA",
 		},
+		{
+			&opts.ClientTypes,
+			"ClientTypes",
+			"CLIENT_TYPE",
+		},
 	}
 	for _, o := range stringEnvOverrides {
 		stringEnvOverride(o.opt, o.varName, o.envName)
@@ -213,6 +287,31 @@ func parseCliArgs(opts *CliOpts) {
 			"NoDataProfiles",
 			"NO_DATA_PROFILES",
 		},
+		{
+			&opts.NoClientArch,
+			"NoClientArch",
+			"NO_CLIENT_ARCH",
+		},
+		{
+			&opts.NoClientProduct,
+			"NoClientProduct",
+			"NO_CLIENT_PRODUCT",
+		},
+		{
+			&opts.NoExtensions,
+			"NoExtensions",
+			"NO_EXTENSIONS",
+		},
+		{
+			&opts.NoClientInstData,
+			"NoClientInstData",
+			"NO_CLIENT_INST_DATA",
+		},
+		{
+			&opts.RegisteredOnly,
+			"RegisteredOnly",
+			"REGISTERED_ONLY",
+		},
 	}
 	for _, o := range boolEnvOverrides {
 		boolEnvOverride(o.opt, o.varName, o.envName)
@@ -222,19 +321,48 @@ func parseCliArgs(opts *CliOpts) {
 	flag.Int64Var(&opts.NumClients, "clients", opts.NumClients, "`NUM_CLIENTS` specifies the number client entries in DATASTORE to act upon.")
 	flag.Int64Var(&opts.NumJobs, "jobs", opts.NumJobs, "`NUM_JOBS` to run in parallel.")
 	flag.StringVar(&opts.DataStore, "datastore", opts.DataStore, "The `DATASTORE` holding the client system information JSON blobs.")
-	flag.StringVar(&opts.Product, "product", opts.Product, "Register the client with this product `IDENTIFIER`.")
-	flag.StringVar(&opts.Version, "version", opts.Version, "Register the client with this product `VERSION`.")
-	flag.StringVar(&opts.Arch, "arch", opts.Arch, "Register the client with this product `ARCH`.")
+	flag.StringVar(&opts.Backend, "backend", opts.Backend, "The `BACKEND` used to store the clients in DATASTORE, either dir or pack.")
+	flag.StringVar(&opts.Product, "product", opts.Product, "Register the client with this product `IDENTIFIER`, rather than its assigned product, if specified.")
+	flag.StringVar(&opts.Version, "version", opts.Version, "Register the client with this product `VERSION`, rather than its assigned product, if specified.")
+	flag.StringVar(&opts.Arch, "arch", opts.Arch, "Register the client with the product for this `ARCH`, rather than the arch in its system information, if specified.")
+	flag.BoolVar(&opts.NoClientArch, "no-client-arch", opts.NoClientArch, "Register each client with the product for ARCH rather than the arch in its system information.")
+	flag.BoolVar(&opts.NoClientProduct, "no-client-product", opts.NoClientProduct, "Register each client with the product IDENTIFIER and VERSION rather than the product assigned to it when generated.")
 	flag.StringVar(&opts.SccHost, "scc-host", opts.SccHost, "The `SCC_HOST` to sent requests to.")
 	flag.StringVar(&opts.ApiCert, "api-cert", opts.ApiCert, "The `API_CERT` to use with specified SCC_HOST.")
 	flag.StringVar(&opts.PrefLang, "lang", opts.PrefLang, "Preferred language `PREF_LANG` to use when interacting with specified SCC_HOST.")
 	flag.StringVar(&opts.RegCode, "regcode", opts.RegCode, "The `REGCODE` to use when registering with specified SCC_HOST.")
 	flag.StringVar(&opts.InstDataPath, "instdata", opts.InstDataPath, "The `INST_DATA` to use when registering with specified SCC_HOST.")
+	flag.BoolVar(&opts.NoClientInstData, "no-client-instdata", opts.NoClientInstData, "Send the INST_DATA for every client rather than each client's own instance data.")
 	flag.BoolVar(&opts.Trace, "trace", opts.Trace, "Enable tracing of operations.")
 	flag.BoolVar(&opts.NoDataProfiles, "no-data-profiles", opts.Trace, "Disable inclusion of data profiles.")
+	flag.BoolVar(&opts.NoExtensions, "no-extensions", opts.NoExtensions, "Disable activation of the clients' extensions when registering.")
+	flag.Var(&opts.Ids, "ids", "Act upon the clients with these `IDS`, a comma separated list of ids and FIRST-LAST ranges, rather than the first NUM_CLIENTS.")
+	flag.BoolVar(&opts.RegisteredOnly, "registered-only", opts.RegisteredOnly, "Only act upon clients that are registered.")
+	flag.StringVar(&opts.ClientTypes, "type", opts.ClientTypes, "Only act upon clients of these comma separated client `TYPES`.")
+	flag.Var(&opts.Sample, "sample", "Act upon a random `SAMPLE` of the selected clients, either a percentage, e.g. 10%, or a number of clients.")
+	flag.Float64Var(&opts.DriftRate, "drift-rate", opts.DriftRate, "The fraction `DRIFT_RATE` of clients whose hardware drifts, for the drift action, or before sending update heartbeats.")
+	flag.Int64Var(&opts.Seed, "seed", opts.Seed, "The `SEED` used to reproducibly sample the clients and drift their hardware, defaults to a random seed.")
 
 	flag.Parse()
 
+	// an explicitly specified product, or arch, overrides the clients'
+	// assigned products, or arches, as if --no-client-product, or
+	// --no-client-arch, had been specified
+	if os.Getenv("IDENTIFIER") != "" || os.Getenv("VERSION") != "" {
+		opts.NoClientProduct = true
+	}
+	if os.Getenv("ARCH") != "" {
+		opts.NoClientArch = true
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "product", "version":
+			opts.NoClientProduct = true
+		case "arch":
+			opts.NoClientArch = true
+		}
+	})
+
 	//
 	// sanity checks
 	//
@@ -253,6 +381,21 @@ func parseCliArgs(opts *CliOpts) {
 		)
 	}
 
+	// fail if the drift rate is invalid
+	if (opts.DriftRate < 0) || (opts.DriftRate > 1) {
+		log.Fatal(
+			"ERROR: The drift rate must be a value between 0 and 1\n",
+		)
+	}
+
+	// drift all of the clients by default for the drift action
+	if opts.Action == ACTION_DRIFT && opts.DriftRate == 0 {
+		opts.DriftRate = 1
+	}
+	if opts.DriftRate > 0 || !opts.Sample.Empty() {
+		log.Printf("Using seed %d for client sampling and drift\n", opts.Seed)
+	}
+
 	// warn if trying to register without specifying REGCODE or INST_DATA
 	if opts.Action == ACTION_REGISTER &&
 		(opts.RegCode == "") && (opts.InstDataPath == "") {
@@ -288,6 +431,124 @@ func parseCliArgs(opts *CliOpts) {
 		}
 	}
 
-	// setup the clientStore
+	// setup the clientStore, locking it against conflicting actions
 	opts.clientStore = clientstore.New(opts.DataStore)
+	if err := opts.clientStore.Lock(opts.lockMode(), opts.appName+" "+opts.Action.String()); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	// fail if the clientStore can't support the requested action
+	if err := validateDataStore(opts); err != nil {
+		log.Fatalf(
+			"ERROR: Invalid DATASTORE %q: %s",
+			opts.DataStore,
+			err.Error(),
+		)
+	}
+
+	// determine the clients to act upon
+	var err error
+	if opts.selected, err = selectClients(opts); err != nil {
+		log.Fatalf(
+			"ERROR: Failed to select clients in DATASTORE %q: %s",
+			opts.DataStore,
+			err.Error(),
+		)
+	}
+
+	// actions sharing the datastore must act upon different clients
+	if opts.lockMode() == clientstore.LOCK_SHARED {
+		if err = opts.clientStore.LockClients(opts.selected); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+	}
+}
+
+// lockMode returns the mode of the datastore lock needed by the action,
+// with updates of dir backend datastores being able to run concurrently,
+// as long as they act upon different clients, whereas the other actions,
+// and pack backend datastores, which only support a single writer, need
+// exclusive use of the datastore.
+func (o *CliOpts) lockMode() clientstore.LockMode {
+	if o.Action == ACTION_UPDATE && o.Backend == clientstore.BACKEND_DIR {
+		return clientstore.LOCK_SHARED
+	}
+	return clientstore.LOCK_EXCLUSIVE
+}
+
+// validateDataStore checks that the datastore's manifest is compatible and
+// that it holds the required number of clients, falling back to checking
+// that the last client exists for datastores that lack a manifest, and
+// switches the clientStore to the BACKEND once it is known to be valid.
+func validateDataStore(opts *CliOpts) (err error) {
+	manifest, err := opts.clientStore.ReadManifest()
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("WARNING: DATASTORE %q has no manifest, generated by an older generator version.\n", opts.DataStore)
+		if err = opts.clientStore.UseBackend(opts.Backend); err != nil {
+			return
+		}
+
+		// the ids are only expanded once known to be held by the datastore
+		if len(opts.Ids) > 0 {
+			for _, idRange := range opts.Ids {
+				for _, id := range []clientstore.FileId{idRange.First, idRange.Last} {
+					if !opts.clientStore.Exists(id, clientstore.SYS_INFO_TYPE) {
+						err = fmt.Errorf(
+							"no system information found for client %d, so can't act upon clients %s",
+							id,
+							idRange,
+						)
+						return
+					}
+				}
+			}
+			return
+		}
+
+		numClients := opts.NumClients
+		lastId := clientstore.FileId(numClients - 1)
+		if numClients > 0 && !opts.clientStore.Exists(lastId, clientstore.SYS_INFO_TYPE) {
+			err = fmt.Errorf(
+				"no system information found for client %d, so can't act upon %d clients",
+				lastId,
+				numClients,
+			)
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	if err = manifest.Validate(); err != nil {
+		return
+	}
+
+	if err = manifest.CheckBackend(opts.Backend); err != nil {
+		return
+	}
+
+	// the ids are only expanded once known to be held by the datastore
+	if len(opts.Ids) > 0 {
+		for _, idRange := range opts.Ids {
+			if err = manifest.CheckIds(idRange.First, idRange.Last); err != nil {
+				return
+			}
+		}
+	} else if err = manifest.CheckClients(opts.NumClients); err != nil {
+		return
+	}
+
+	// rewritten files, e.g. drifted sysinfo, are compressed like the rest
+	opts.clientStore.SetCompression(manifest.Compression != "")
+
+	// the clients may have data profiles of types that were registered by
+	// the generator, which must also be sent as data profiles
+	for _, profileType := range manifest.ProfileTypes {
+		profile.Register(profileType)
+	}
+
+	err = opts.clientStore.UseBackend(opts.Backend)
+
+	return
 }
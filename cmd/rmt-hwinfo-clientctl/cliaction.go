@@ -12,6 +12,8 @@ const (
 	ACTION_REGISTER CliAction = iota
 	ACTION_UPDATE
 	ACTION_DEREGISTER
+	ACTION_DRIFT
+	ACTION_RECOVER
 	numActions
 )
 
@@ -19,6 +21,8 @@ var modeNames = [numActions]string{
 	ACTION_REGISTER:   "register",
 	ACTION_UPDATE:     "update",
 	ACTION_DEREGISTER: "deregister",
+	ACTION_DRIFT:      "drift",
+	ACTION_RECOVER:    "recover",
 }
 
 func (m *CliAction) String() (mode string) {
@@ -63,8 +63,23 @@ func deregisterClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 		connectOpts.Certificate = cliOpts.cert
 	}
 
+	// journal the attempt so that recover can identify deregistrations
+	// interrupted by a crash
+	err = regInfo.Journal(id, clientstore.REG_STATE_DEREGISTERING, cliOpts.clientStore)
+	if err != nil {
+		err = fmt.Errorf(
+			"deregisterClient client %q failed to journal deregistration: %w",
+			hostname,
+			err,
+		)
+		return
+	}
+
 	// we want to delete the existing registration anyway
-	defer regInfo.Delete(id, cliOpts.clientStore)
+	defer func() {
+		_ = regInfo.Delete(id, cliOpts.clientStore)
+		_ = regInfo.Journal(id, clientstore.REG_STATE_UNREGISTERED, cliOpts.clientStore)
+	}()
 
 	trace("Setup connection for client %q", hostname)
 	conn := connection.New(connectOpts, &sccCreds)
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rtamalin/rmt-client-testing/internal/client"
+	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+	"github.com/rtamalin/rmt-client-testing/internal/profile"
+)
+
+// kinds of hardware drift that can be applied to a client
+const (
+	DRIFT_MEMORY  = "memory"
+	DRIFT_MODULES = "modules"
+	DRIFT_DEVICES = "devices"
+)
+
+var driftKinds = []string{
+	DRIFT_MEMORY,
+	DRIFT_MODULES,
+	DRIFT_DEVICES,
+}
+
+// kernel modules that a drifting client may load
+var driftModules = []string{
+	"bonding",
+	"br_netfilter",
+	"dm_crypt",
+	"fuse",
+	"loop",
+	"nf_conntrack",
+	"overlay",
+	"tun",
+	"usb_storage",
+	"vxlan",
+}
+
+// DriftStats counts the drifted clients and the changes applied to them.
+type DriftStats struct {
+	Clients atomic.Int64
+	Memory  atomic.Int64
+	Modules atomic.Int64
+	Devices atomic.Int64
+}
+
+var driftStats DriftStats
+
+func (d *DriftStats) record(kind string) {
+	d.Clients.Add(1)
+	switch kind {
+	case DRIFT_MEMORY:
+		d.Memory.Add(1)
+	case DRIFT_MODULES:
+		d.Modules.Add(1)
+	case DRIFT_DEVICES:
+		d.Devices.Add(1)
+	}
+}
+
+func (d *DriftStats) Summary() string {
+	entries := []struct {
+		name  string
+		value int64
+	}{
+		{"Total", d.Clients.Load()},
+		{"Memory", d.Memory.Load()},
+		{"Modules", d.Modules.Load()},
+		{"Devices", d.Devices.Load()},
+	}
+
+	result := []string{"Client Drift Stats:"}
+	for _, e := range entries {
+		result = append(result, fmt.Sprintf("  %-16s %13d", e.name+":", e.value))
+	}
+	return strings.Join(result, "\n")
+}
+
+// driftClient randomly drifts the client's stored system information, with
+// a probability of the specified drift rate.
+func driftClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
+	sysInfo := SysInfo{}
+
+	// load the saved system information
+	err = sysInfo.Load(id, cliOpts.clientStore)
+	if err != nil {
+		err = fmt.Errorf(
+			"driftClient clientid %d failed to load sysInfo: %w",
+			id,
+			err,
+		)
+		return
+	}
+
+	_, err = maybeDriftSysInfo(id, sysInfo, cliOpts)
+
+	return
+}
+
+// maybeDriftSysInfo drifts the client's system information, with a
+// probability of the specified drift rate, saving the drifted system
+// information and returning true if it was drifted. The drift is chosen
+// using a random source determined by the seed and client id, so that it
+// can be reproduced by specifying the same seed.
+func maybeDriftSysInfo(id clientstore.FileId, sysInfo SysInfo, cliOpts *CliOpts) (drifted bool, err error) {
+	r := client.NewRand(cliOpts.Seed, client.ClientId(id))
+	if r.Float64() >= cliOpts.DriftRate {
+		return
+	}
+
+	hostname := sysInfo["hostname"].(string)
+
+	kind, err := driftSysInfo(sysInfo, r)
+	if err != nil {
+		err = fmt.Errorf(
+			"driftClient client %q failed to drift: %w",
+			hostname,
+			err,
+		)
+		return
+	}
+
+	err = sysInfo.Save(id, cliOpts.clientStore)
+	if err != nil {
+		err = fmt.Errorf(
+			"driftClient client %q failed to save drifted sysInfo: %w",
+			hostname,
+			err,
+		)
+		return
+	}
+
+	driftStats.record(kind)
+	drifted = true
+	trace("Drifted %s of client %q", kind, hostname)
+
+	return
+}
+
+// driftSysInfo applies a randomly chosen kind of drift to the system
+// information, falling back to other kinds if the chosen one can't be
+// applied. Drifted data profiles are replaced with new profiles with
+// recomputed identifiers.
+func driftSysInfo(sysInfo SysInfo, r *rand.Rand) (kind string, err error) {
+	for _, i := range r.Perm(len(driftKinds)) {
+		var applied bool
+
+		kind = driftKinds[i]
+		switch kind {
+		case DRIFT_MEMORY:
+			applied = driftMemory(sysInfo)
+		case DRIFT_MODULES:
+			applied, err = driftModList(sysInfo, r)
+		case DRIFT_DEVICES:
+			applied, err = driftPciData(sysInfo, r)
+		}
+		if err != nil {
+			return
+		}
+
+		if applied {
+			return
+		}
+	}
+
+	err = fmt.Errorf("no applicable drift for system information")
+
+	return
+}
+
+// profileData returns the data of the named data profile, if present
+func profileData(sysInfo SysInfo, spName string) (data any, found bool) {
+	switch pInfo := sysInfo[spName].(type) {
+	case map[string]any:
+		data, found = pInfo["data"]
+	case *profile.ProfileInfo:
+		data, found = pInfo.Data, true
+	}
+	return
+}
+
+// largest total memory, in MiB, that a memory upgrade can result in,
+// matching that of the largest bare metal instances
+const driftMaxMemory = 24 << 20
+
+// simulate a memory upgrade by doubling the total memory, unless that
+// would exceed the largest supported total memory
+func driftMemory(sysInfo SysInfo) bool {
+	memTotal, ok := sysInfo["mem_total"].(float64)
+	if !ok || memTotal <= 0 || memTotal*2 > driftMaxMemory {
+		return false
+	}
+
+	sysInfo["mem_total"] = memTotal * 2
+
+	return true
+}
+
+// simulate loading or unloading a kernel module
+func driftModList(sysInfo SysInfo, r *rand.Rand) (applied bool, err error) {
+	data, found := profileData(sysInfo, profile.MOD_LIST)
+	if !found {
+		return
+	}
+
+	entries, ok := data.([]any)
+	if !ok {
+		err = fmt.Errorf("unexpected %s data type %T", profile.MOD_LIST, data)
+		return
+	}
+	modList := make([]string, 0, len(entries)+1)
+	for _, e := range entries {
+		modList = append(modList, e.(string))
+	}
+
+	// candidates for loading are those not already loaded
+	var unloaded []string
+	for _, mod := range driftModules {
+		if !slices.Contains(modList, mod) {
+			unloaded = append(unloaded, mod)
+		}
+	}
+
+	switch {
+	case len(unloaded) > 0 && (len(modList) == 0 || r.Intn(2) == 0):
+		modList = append(modList, unloaded[r.Intn(len(unloaded))])
+	case len(modList) > 0:
+		i := r.Intn(len(modList))
+		modList = slices.Delete(modList, i, i+1)
+	default:
+		return
+	}
+
+	// lsmod based module lists are sorted
+	slices.Sort(modList)
+	sysInfo[profile.MOD_LIST] = profile.NewProfileInfo(modList)
+	applied = true
+
+	return
+}
+
+// pciRecord is a device entry in pci_data, which is a single line, or a
+// multi-line record for the lspci -vmm format.
+type pciRecord struct {
+	slot  string
+	lines []string
+}
+
+var pciSlotRe = regexp.MustCompile(`^((?:[0-9a-f]{4}:)?)([0-9a-f]{2}):([0-9a-f]{2})\.([0-7])$`)
+
+// markers identifying the disk and GPU device records in the supported
+// pci_data formats, by class name or by numeric class id
+var (
+	diskMarkers = []string{
+		"Non-Volatile memory controller",
+		"SCSI storage controller",
+		" 0108: ",
+		" 0100: ",
+	}
+	gpuMarkers = []string{
+		"3D controller",
+		" 0302: ",
+	}
+)
+
+func (rec *pciRecord) matches(markers []string) bool {
+	text := strings.Join(rec.lines, "\n")
+	for _, marker := range markers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// bus and slot numbers of the record
+func (rec *pciRecord) busSlot() (bus, slot int, ok bool) {
+	match := pciSlotRe.FindStringSubmatch(rec.slot)
+	if match == nil {
+		return
+	}
+	b, _ := strconv.ParseInt(match[2], 16, 0)
+	s, _ := strconv.ParseInt(match[3], 16, 0)
+	return int(b), int(s), true
+}
+
+// copy of the record moved to the specified slot on the same bus
+func (rec *pciRecord) moveTo(slot int) pciRecord {
+	match := pciSlotRe.FindStringSubmatch(rec.slot)
+	newSlot := fmt.Sprintf("%s%s:%02x.0", match[1], match[2], slot)
+
+	moved := pciRecord{
+		slot:  newSlot,
+		lines: slices.Clone(rec.lines),
+	}
+	for i, line := range moved.lines {
+		switch {
+		case strings.HasPrefix(line, rec.slot+" "):
+			moved.lines[i] = newSlot + strings.TrimPrefix(line, rec.slot)
+		case line == "Slot:\t"+rec.slot:
+			moved.lines[i] = "Slot:\t" + newSlot
+		}
+	}
+	return moved
+}
+
+func parsePciRecords(data string) (records []pciRecord, vmm bool) {
+	vmm = strings.HasPrefix(data, "Slot:\t")
+	if vmm {
+		for _, block := range strings.Split(strings.TrimRight(data, "\n"), "\n\n") {
+			rec := pciRecord{lines: strings.Split(block, "\n")}
+			for _, line := range rec.lines {
+				if slot, found := strings.CutPrefix(line, "Slot:\t"); found {
+					rec.slot = slot
+				}
+			}
+			records = append(records, rec)
+		}
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(data, "\n"), "\n") {
+		slot, _, _ := strings.Cut(line, " ")
+		records = append(records, pciRecord{slot: slot, lines: []string{line}})
+	}
+	return
+}
+
+func formatPciRecords(records []pciRecord, vmm bool) string {
+	var sb strings.Builder
+	for _, rec := range records {
+		sb.WriteString(strings.Join(rec.lines, "\n"))
+		sb.WriteString("\n")
+		if vmm {
+			// records are separated by a blank line
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+var unameCountRe = regexp.MustCompile(`(\d+) (Disks|GPUs)`)
+
+// increment the count of the specified kind of device in the uname
+func incrementUnameCount(uname, kind string) string {
+	for _, match := range unameCountRe.FindAllStringSubmatch(uname, -1) {
+		if match[2] == kind {
+			count, _ := strconv.Atoi(match[1])
+			return strings.Replace(uname, match[0], fmt.Sprintf("%d %s", count+1, kind), 1)
+		}
+	}
+	return uname
+}
+
+// simulate adding a disk or GPU by duplicating one of the client's
+// existing disk or GPU devices into the next free slot on its bus, with
+// an added disk also being added to the block device layout
+func driftPciData(sysInfo SysInfo, r *rand.Rand) (applied bool, err error) {
+	data, found := profileData(sysInfo, profile.PCI_DATA)
+	if !found {
+		return
+	}
+
+	pciData, ok := data.(string)
+	if !ok {
+		err = fmt.Errorf("unexpected %s data type %T", profile.PCI_DATA, data)
+		return
+	}
+
+	records, vmm := parsePciRecords(pciData)
+	var candidates []int
+	for i := range records {
+		if records[i].matches(diskMarkers) || records[i].matches(gpuMarkers) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	source := &records[candidates[r.Intn(len(candidates))]]
+	bus, _, ok := source.busSlot()
+	if !ok {
+		err = fmt.Errorf("invalid PCI slot %q", source.slot)
+		return
+	}
+
+	// find the last used slot on the bus
+	last, lastSlot := -1, -1
+	for i := range records {
+		if b, s, ok := records[i].busSlot(); ok && b == bus {
+			last = i
+			lastSlot = max(lastSlot, s)
+		}
+	}
+	if lastSlot >= 0x1f {
+		// no free slots left on the bus
+		return
+	}
+
+	added := source.moveTo(lastSlot + 1)
+	isGPU := source.matches(gpuMarkers)
+	if !isGPU {
+		var diskAdded bool
+		if diskAdded, err = driftBlkData(sysInfo); err != nil || !diskAdded {
+			return
+		}
+	}
+	records = slices.Insert(records, last+1, added)
+	sysInfo[profile.PCI_DATA] = profile.NewProfileInfo(formatPciRecords(records, vmm))
+
+	// keep the device counts reported in the uname consistent
+	if uname, ok := sysInfo["uname"].(string); ok {
+		kind := "Disks"
+		if isGPU {
+			kind = "GPUs"
+		}
+		sysInfo["uname"] = incrementUnameCount(uname, kind)
+	}
+	applied = true
+
+	return
+}
+
+var (
+	blkNvmeRe   = regexp.MustCompile(`^nvme(\d+)n1$`)
+	blkLetterRe = regexp.MustCompile(`^(sd|vd|dasd)([a-z]+)$`)
+)
+
+// name of the disk following the named disk, if any, with the letters of
+// kernel style disk names following z with aa, az with ba, and so on
+func nextDiskName(name string) (next string, ok bool) {
+	if match := blkNvmeRe.FindStringSubmatch(name); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		return fmt.Sprintf("nvme%dn1", n+1), true
+	}
+	if match := blkLetterRe.FindStringSubmatch(name); match != nil {
+		letters := []byte(match[2])
+		i := len(letters) - 1
+		for ; i >= 0 && letters[i] == 'z'; i-- {
+			letters[i] = 'a'
+		}
+		if i < 0 {
+			letters = append([]byte{'a'}, letters...)
+		} else {
+			letters[i]++
+		}
+		return match[1] + string(letters), true
+	}
+	return
+}
+
+// add a disk, the same size as the client's last disk, to the block device
+// layout, returning false if the layout has no disks, or the disk can't be
+// named, with clients lacking a layout having nothing to add it to
+func driftBlkData(sysInfo SysInfo) (added bool, err error) {
+	data, found := profileData(sysInfo, profile.BLK_DATA)
+	if !found {
+		added = true
+		return
+	}
+
+	blkData, ok := data.(string)
+	if !ok {
+		err = fmt.Errorf("unexpected %s data type %T", profile.BLK_DATA, data)
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(blkData, "\n"), "\n")
+	var lastDisk []string
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) >= 3 && fields[2] == "disk" {
+			lastDisk = fields
+		}
+	}
+	if lastDisk == nil {
+		return
+	}
+
+	name, ok := nextDiskName(lastDisk[0])
+	if !ok {
+		return
+	}
+
+	// add a blank last line to create a trailing newline
+	lines = append(lines, fmt.Sprintf("%s %s disk ", name, lastDisk[1]), "")
+	sysInfo[profile.BLK_DATA] = profile.NewProfileInfo(strings.Join(lines, "\n"))
+	added = true
+
+	return
+}
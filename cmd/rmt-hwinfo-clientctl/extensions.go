@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SUSE/connect-ng/pkg/connection"
+	"github.com/SUSE/connect-ng/pkg/registration"
+	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+	"github.com/rtamalin/rmt-client-testing/internal/workqueue"
+)
+
+// ActivationStats records the durations of the successful activations of
+// each extension, and the number of failed activations.
+type ActivationStats struct {
+	mutex    sync.Mutex
+	timings  map[string]*workqueue.StatBlock
+	failures map[string]int64
+}
+
+var activationStats = ActivationStats{
+	timings:  make(map[string]*workqueue.StatBlock),
+	failures: make(map[string]int64),
+}
+
+func (a *ActivationStats) Record(extension string, start, end time.Time, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err != nil {
+		a.failures[extension]++
+		return
+	}
+
+	if _, found := a.timings[extension]; !found {
+		a.timings[extension] = workqueue.NewStatBlock(extension, "s")
+	}
+	a.timings[extension].Update(end.Sub(start).Seconds(), start, end)
+}
+
+func (a *ActivationStats) Empty() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return len(a.timings) == 0 && len(a.failures) == 0
+}
+
+func (a *ActivationStats) Summary() string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	extensions := make([]string, 0, len(a.timings))
+	for extension := range a.timings {
+		extensions = append(extensions, extension)
+	}
+	for extension := range a.failures {
+		if _, found := a.timings[extension]; !found {
+			extensions = append(extensions, extension)
+		}
+	}
+	sort.Strings(extensions)
+
+	result := []string{}
+	for _, extension := range extensions {
+		opts := workqueue.SummaryOpts{
+			workqueue.OPT_NAME:   "Activate " + extension,
+			workqueue.OPT_FOOTER: fmt.Sprintf("  %-16s %13d", "Failed:", a.failures[extension]),
+		}
+
+		// min & max are only meaningful if there were any activations
+		timings, found := a.timings[extension]
+		if found {
+			opts[workqueue.OPT_MIN_MAX] = true
+		} else {
+			timings = workqueue.NewStatBlock(extension, "s")
+		}
+
+		result = append(result, timings.Summary(opts))
+	}
+	return strings.Join(result, "\n")
+}
+
+// loadClientInfo loads the client's generation details, returning nil if
+// the datastore was generated without them.
+func loadClientInfo(id clientstore.FileId, cliOpts *CliOpts) (clientInfo *clientstore.ClientInfo, err error) {
+	clientInfo, err = cliOpts.clientStore.ReadClientInfo(id)
+	if errors.Is(err, os.ErrNotExist) {
+		clientInfo, err = nil, nil
+	}
+	return
+}
+
+// activateExtensions activates the client's extensions, in order, after
+// its base product, recording the outcome of each activation. Failures
+// are reported without failing the registration, as the base product
+// remains activated.
+func activateExtensions(conn connection.Connection, hostname string, clientInfo *clientstore.ClientInfo, version, arch string) {
+	for _, extension := range clientInfo.Extensions {
+		trace("Activating %s/%s/%s for client %q", extension, version, arch, hostname)
+
+		start := time.Now()
+		_, product, err := registration.Activate(conn, extension, version, arch, "")
+		activationStats.Record(extension, start, time.Now(), err)
+		if err != nil {
+			log.Printf(
+				"WARNING: client %q failed to activate extension %s/%s/%s: %s",
+				hostname,
+				extension,
+				version,
+				arch,
+				err.Error(),
+			)
+			continue
+		}
+		trace("%s activated for client %q", product.FriendlyName, hostname)
+	}
+}
@@ -1,21 +1,42 @@
 package main
 
 import (
+	"errors"
+	"os"
+
 	"github.com/SUSE/connect-ng/pkg/registration"
+	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+	"github.com/rtamalin/rmt-client-testing/internal/profile"
 )
 
-func prepareExtraData(sysInfo SysInfo, cliOpts *CliOpts) (registration.DataProfiles, registration.ExtraData) {
+// loadClientInstData returns the client's own instance data, falling back
+// to the INST_DATA if disabled, or if the client has none, as is the case
+// for clients not hosted by a cloud provider.
+func loadClientInstData(id clientstore.FileId, cliOpts *CliOpts) (instData string, err error) {
+	instData = cliOpts.instData
+	if cliOpts.NoClientInstData {
+		return
+	}
+
+	data, err := cliOpts.clientStore.ReadFile(id, clientstore.INST_DATA_TYPE)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		err = nil
+	case err == nil:
+		instData = string(data)
+	}
+
+	return
+}
+
+func prepareExtraData(sysInfo SysInfo, instData string, cliOpts *CliOpts) (registration.DataProfiles, registration.ExtraData) {
 	extraData := registration.ExtraData{
-		"instance_data": cliOpts.instData,
+		"instance_data": instData,
 	}
 
 	// add system profiles to extraData.dataProfiles, removing them from sysInfo
 	systemProfiles := registration.DataProfiles{}
-	spNames := []string{
-		"pci_data",
-		"mod_list",
-	}
-	for _, spName := range spNames {
+	for _, spName := range profile.Types() {
 		// skip if spName entry not in sysInfo
 		if _, ok := sysInfo[spName]; !ok {
 			continue
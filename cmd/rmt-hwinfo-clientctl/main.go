@@ -22,6 +22,10 @@ func performAction(id uint32, opts *CliOpts) (err error) {
 		err = updateClient(fileId, opts)
 	case ACTION_DEREGISTER:
 		err = deregisterClient(fileId, opts)
+	case ACTION_DRIFT:
+		err = driftClient(fileId, opts)
+	case ACTION_RECOVER:
+		err = recoverClient(fileId, opts)
 	}
 	return
 }
@@ -102,18 +106,29 @@ func main() {
 		workqueue.OPT_EXTRA_STATS: true,
 	}
 
+	if cliOpts.Action == ACTION_RECOVER {
+		if err := loadJournal(&cliOpts); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+	}
+
 	wq := workqueue.NewWorkQueue(cliOpts.Action.String(), cliOpts.NumJobs)
 
 	wq.Start()
-	for i := int64(0); i < cliOpts.NumClients; i++ {
-		job := wq.NewJob(i, func() error {
-			return performAction(uint32(i), &cliOpts)
+	for _, id := range cliOpts.selected {
+		job := wq.NewJob(int64(id), func() error {
+			return performAction(uint32(id), &cliOpts)
 		})
 		wq.Add(job)
 	}
 
 	wq.WaitForCompletion()
 
+	// close the clientStore even if some actions failed, to save its state
+	if err := cliOpts.clientStore.Close(); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
 	if len(wq.Errors) > 0 {
 		log.Printf("ERROR: %v action failures occurred:\n", len(wq.Errors))
 		for _, actErr := range wq.Errors {
@@ -122,12 +137,23 @@ func main() {
 		log.Fatal("ERROR: failed due to above errors.")
 	}
 
+	stats := []string{
+		wq.Stats.JobStats().Summary(clientStatOpts),
+		wq.Stats.PoolStats().Summary(parallelStatOpts),
+	}
+	if cliOpts.DriftRate > 0 {
+		stats = append(stats, driftStats.Summary())
+	}
+	if !activationStats.Empty() {
+		stats = append(stats, activationStats.Summary())
+	}
+	if cliOpts.Action == ACTION_RECOVER {
+		stats = append(stats, recoveryStats.Summary())
+	}
+
 	SaveStats(
 		&cliOpts,
-		[]string{
-			wq.Stats.JobStats().Summary(clientStatOpts),
-			wq.Stats.PoolStats().Summary(parallelStatOpts),
-		},
+		stats,
 		true, /* write to stdout */
 	)
 }
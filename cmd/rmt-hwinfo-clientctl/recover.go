@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+)
+
+// RecoveryStats counts the outcomes of recovering the clients.
+type RecoveryStats struct {
+	Consistent atomic.Int64
+	Restored   atomic.Int64
+	Retained   atomic.Int64
+	Abandoned  atomic.Int64
+	Removed    atomic.Int64
+}
+
+var recoveryStats RecoveryStats
+
+func (r *RecoveryStats) Summary() string {
+	entries := []struct {
+		name  string
+		value int64
+	}{
+		{"Consistent", r.Consistent.Load()},
+		{"Restored", r.Restored.Load()},
+		{"Retained", r.Retained.Load()},
+		{"Abandoned", r.Abandoned.Load()},
+		{"Removed", r.Removed.Load()},
+	}
+
+	result := []string{"Client Recovery Stats:"}
+	for _, e := range entries {
+		result = append(result, fmt.Sprintf("  %-16s %13d", e.name+":", e.value))
+	}
+	return strings.Join(result, "\n")
+}
+
+// latest journal entry of each client, loaded before recovering them
+var journalEntries map[clientstore.FileId]*clientstore.JournalEntry
+
+func loadJournal(opts *CliOpts) (err error) {
+	journalEntries, err = opts.clientStore.ReadJournal()
+	return
+}
+
+// recoverClient makes the client's saved registration information
+// consistent with the latest registration state recorded for it in the
+// journal, e.g. after clientctl was killed part way through an action.
+func recoverClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
+	clientStore := cliOpts.clientStore
+	regInfo := RegInfo{}
+
+	exists := RegInfoExists(id, clientStore)
+	valid := exists && regInfo.Load(id, clientStore) == nil
+
+	var state clientstore.RegState
+	entry := journalEntries[id]
+	if entry != nil {
+		state = entry.State
+	}
+
+	switch {
+	case state == clientstore.REG_STATE_REGISTERED:
+		// restore the journaled registration info if missing, damaged or
+		// superseded by a save that was interrupted
+		current, _ := json.Marshal(&regInfo)
+		if valid && bytes.Equal(current, entry.Data) {
+			recoveryStats.Consistent.Add(1)
+			return
+		}
+
+		journaled := RegInfo{}
+		if err = json.Unmarshal(entry.Data, &journaled); err == nil {
+			err = journaled.Save(id, clientStore)
+		}
+		if err != nil {
+			err = fmt.Errorf(
+				"recoverClient clientid %d failed to restore journaled regInfo: %w",
+				id,
+				err,
+			)
+			return
+		}
+		recoveryStats.Restored.Add(1)
+		bold("Client %08d registration info restored", id)
+
+	case state == clientstore.REG_STATE_DEREGISTERING && valid:
+		// keep the credentials so that the deregistration can be retried
+		if err = regInfo.Journal(id, clientstore.REG_STATE_REGISTERED, clientStore); err != nil {
+			err = fmt.Errorf(
+				"recoverClient clientid %d failed to journal retained regInfo: %w",
+				id,
+				err,
+			)
+			return
+		}
+		recoveryStats.Retained.Add(1)
+		bold("Client %08d interrupted deregistration retained for retry", id)
+
+	case state == clientstore.REG_STATE_REGISTERING || state == clientstore.REG_STATE_DEREGISTERING:
+		// without its credentials the client can't be acted upon, though
+		// the server may still consider it registered
+		if exists {
+			_ = regInfo.Delete(id, clientStore)
+		}
+		if err = regInfo.Journal(id, clientstore.REG_STATE_UNREGISTERED, clientStore); err != nil {
+			err = fmt.Errorf(
+				"recoverClient clientid %d failed to journal abandoned registration: %w",
+				id,
+				err,
+			)
+			return
+		}
+		recoveryStats.Abandoned.Add(1)
+		log.Printf(
+			"WARNING: Client %08d was interrupted while %s, and may remain registered with the server",
+			id,
+			state,
+		)
+
+	case exists && (state == clientstore.REG_STATE_UNREGISTERED || !valid):
+		// remove stale registration info, or damaged registration info
+		// that was never journaled, e.g. saved by an older version
+		if err = regInfo.Delete(id, clientStore); err != nil {
+			err = fmt.Errorf(
+				"recoverClient clientid %d failed to remove stale regInfo: %w",
+				id,
+				err,
+			)
+			return
+		}
+		recoveryStats.Removed.Add(1)
+		bold("Client %08d stale registration info removed", id)
+
+	default:
+		recoveryStats.Consistent.Add(1)
+	}
+
+	return
+}
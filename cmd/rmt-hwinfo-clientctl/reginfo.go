@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 
 	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
 )
@@ -42,10 +41,15 @@ func (ri *RegInfo) Load(fileId clientstore.FileId, clientStore *clientstore.Clie
 		return
 	}
 
-	parseErr := json.Unmarshal(riBytes, ri)
-	if parseErr != nil {
-		fmt.Fprintf(os.Stderr, "Error unmarshalling registration information JSON: %v\n", parseErr)
-		os.Exit(1)
+	// a damaged file fails just this client, and can be fixed by recover
+	err = json.Unmarshal(riBytes, ri)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to parse registration information JSON from %q: %w",
+			fileId.Path(fileType),
+			err,
+		)
+		return
 	}
 
 	//trace("Loaded regInfo: %+v", ri)
@@ -79,3 +83,23 @@ func (ri *RegInfo) Save(fileId clientstore.FileId, clientStore *clientstore.Clie
 
 	return
 }
+
+// Journal records the client's transition to the specified registration
+// state, including the registration information of registered clients so
+// that recover can restore it.
+func (ri *RegInfo) Journal(fileId clientstore.FileId, state clientstore.RegState, clientStore *clientstore.ClientStore) (err error) {
+	var riBytes []byte
+	if state == clientstore.REG_STATE_REGISTERED {
+		riBytes, err = json.Marshal(ri)
+		if err != nil {
+			err = fmt.Errorf(
+				"failed to generate RegInfo JSON for %+v: %w",
+				ri,
+				err,
+			)
+			return
+		}
+	}
+
+	return clientStore.Journal(fileId, state, riBytes)
+}
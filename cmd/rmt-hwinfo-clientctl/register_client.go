@@ -27,8 +27,32 @@ func registerClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 		return
 	}
 
+	// load the client's instance data
+	instData, err := loadClientInstData(id, cliOpts)
+	if err != nil {
+		err = fmt.Errorf(
+			"registerClient clientid %d failed to load instance data: %w",
+			id,
+			err,
+		)
+		return
+	}
+
 	// generate the client's extraData
-	_, extraData := prepareExtraData(sysInfo, cliOpts)
+	_, extraData := prepareExtraData(sysInfo, instData, cliOpts)
+
+	// load the client's assigned product and extensions, unless disabled
+	var clientInfo *clientstore.ClientInfo
+	if !cliOpts.NoClientProduct || !cliOpts.NoExtensions {
+		if clientInfo, err = loadClientInfo(id, cliOpts); err != nil {
+			err = fmt.Errorf(
+				"registerClient clientid %d failed to load client info: %w",
+				id,
+				err,
+			)
+			return
+		}
+	}
 
 	if cliOpts.SccHost != "" {
 		connectOpts.URL = cliOpts.SccHost
@@ -47,6 +71,20 @@ func registerClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 	// retrieve the hostname from sysInfo
 	hostname := sysInfo["hostname"].(string)
 
+	// use the client's own arch if available, unless requested otherwise
+	arch := cliOpts.Arch
+	if !cliOpts.NoClientArch {
+		if clientArch, ok := sysInfo["arch"].(string); ok && clientArch != "" {
+			arch = clientArch
+		}
+	}
+
+	// use the client's assigned product if requested and available
+	product, version := cliOpts.Product, cliOpts.Version
+	if !cliOpts.NoClientProduct && clientInfo != nil && clientInfo.Product != nil {
+		product, version = clientInfo.Product.Identifier, clientInfo.Product.Version
+	}
+
 	// fail if attempting to register a client that already exists
 	if RegInfoExists(id, cliOpts.clientStore) {
 		trace("client registration already exists for %q", hostname)
@@ -57,6 +95,24 @@ func registerClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 		return
 	}
 
+	// journal the attempt, and its failure, so that recover can identify
+	// registrations interrupted by a crash
+	regInfo := RegInfo{}
+	if err = regInfo.Journal(id, clientstore.REG_STATE_REGISTERING, cliOpts.clientStore); err != nil {
+		err = fmt.Errorf(
+			"registerClient client %q failed to journal registration: %w",
+			hostname,
+			err,
+		)
+		return
+	}
+	registered := false
+	defer func() {
+		if err != nil && !registered {
+			_ = regInfo.Journal(id, clientstore.REG_STATE_UNREGISTERED, cliOpts.clientStore)
+		}
+	}()
+
 	trace("Setup connection for client %q", hostname)
 	conn := connection.New(connectOpts, &sccCreds)
 
@@ -105,15 +161,15 @@ func registerClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 	}
 	trace("check %s/systems/%d", connectOpts.URL, regId)
 
-	trace("Activating %s/%s/%s for client %q", cliOpts.Product, cliOpts.Version, cliOpts.Arch, hostname)
-	_, root, err := registration.Activate(conn, cliOpts.Product, cliOpts.Version, cliOpts.Arch, cliOpts.RegCode)
+	trace("Activating %s/%s/%s for client %q", product, version, arch, hostname)
+	_, root, err := registration.Activate(conn, product, version, arch, cliOpts.RegCode)
 	if err != nil {
 		err = fmt.Errorf(
 			"registerClient client %q failed to activate %s/%s/%s using reg code: %w",
 			hostname,
-			cliOpts.Product,
-			cliOpts.Version,
-			cliOpts.Arch,
+			product,
+			version,
+			arch,
 			err,
 		)
 		// deregister the client if the activation fails
@@ -122,12 +178,19 @@ func registerClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 	}
 	trace("%s activated for client %q", root.FriendlyName, hostname)
 
-	// record registration info
-	regInfo := RegInfo{
-		SccCreds: sccCreds,
+	if clientInfo != nil && !cliOpts.NoExtensions {
+		activateExtensions(conn, hostname, clientInfo, version, arch)
 	}
 
-	err = regInfo.Save(id, cliOpts.clientStore)
+	// record registration info, journaling it first so that it can be
+	// recovered if saving it is interrupted
+	registered = true
+	regInfo.SccCreds = sccCreds
+
+	err = regInfo.Journal(id, clientstore.REG_STATE_REGISTERED, cliOpts.clientStore)
+	if err == nil {
+		err = regInfo.Save(id, cliOpts.clientStore)
+	}
 	if err != nil {
 		err = fmt.Errorf(
 			"registerClient client %q failed to save registration info: %w",
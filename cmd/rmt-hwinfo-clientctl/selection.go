@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+)
+
+// IdRange is an inclusive range of client ids.
+type IdRange struct {
+	First clientstore.FileId
+	Last  clientstore.FileId
+}
+
+func (r IdRange) String() string {
+	if r.First == r.Last {
+		return strconv.FormatUint(uint64(r.First), 10)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// IdRanges is the list of client id ranges specified via --ids, as a comma
+// separated list of ids and FIRST-LAST ranges, e.g. 10-500,900.
+type IdRanges []IdRange
+
+func (r *IdRanges) String() string {
+	ranges := make([]string, len(*r))
+	for i, idRange := range *r {
+		ranges[i] = idRange.String()
+	}
+	return strings.Join(ranges, ",")
+}
+
+func parseId(value string) (id clientstore.FileId, err error) {
+	val, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32)
+	if err != nil || val >= math.MaxUint32 {
+		err = fmt.Errorf(
+			"invalid client id %q, must be a value between 0 and MaxUint32",
+			value,
+		)
+		return
+	}
+	id = clientstore.FileId(val)
+	return
+}
+
+func (r *IdRanges) Set(value string) (err error) {
+	var ranges IdRanges
+	for _, entry := range strings.Split(value, ",") {
+		var idRange IdRange
+		first, last, isRange := strings.Cut(entry, "-")
+		if idRange.First, err = parseId(first); err != nil {
+			return
+		}
+		idRange.Last = idRange.First
+		if isRange {
+			if idRange.Last, err = parseId(last); err != nil {
+				return
+			}
+		}
+		if idRange.Last < idRange.First {
+			err = fmt.Errorf(
+				"invalid client id range %q, the last id must not be less than the first",
+				entry,
+			)
+			return
+		}
+		ranges = append(ranges, idRange)
+	}
+
+	*r = ranges
+	return
+}
+
+// ids returns the specified client ids in ascending order, without
+// duplicates, expanding the ranges, so they must first be checked against
+// the clients held by the datastore.
+func (r IdRanges) ids() (ids []clientstore.FileId) {
+	for _, idRange := range r {
+		for id := idRange.First; ; id++ {
+			ids = append(ids, id)
+			if id == idRange.Last {
+				break
+			}
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// SampleSpec is the random sample of the selected clients to act upon,
+// specified via --sample as either a percentage, e.g. 10%, or a number of
+// clients.
+type SampleSpec struct {
+	Percent float64
+	Count   int64
+}
+
+func (s *SampleSpec) String() string {
+	switch {
+	case s.Percent > 0:
+		return strconv.FormatFloat(s.Percent, 'f', -1, 64) + "%"
+	case s.Count > 0:
+		return strconv.FormatInt(s.Count, 10)
+	}
+	return ""
+}
+
+func (s *SampleSpec) Set(value string) (err error) {
+	var sample SampleSpec
+	if percent, isPercent := strings.CutSuffix(value, "%"); isPercent {
+		sample.Percent, err = strconv.ParseFloat(percent, 64)
+		if err != nil || sample.Percent <= 0 || sample.Percent > 100 {
+			err = fmt.Errorf(
+				"invalid sample percentage %q, must be a value between 0 and 100",
+				value,
+			)
+			return
+		}
+	} else {
+		sample.Count, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || sample.Count <= 0 {
+			err = fmt.Errorf(
+				"invalid sample %q, must be a percentage, or a positive number of clients",
+				value,
+			)
+			return
+		}
+	}
+
+	*s = sample
+	return
+}
+
+// Empty returns true if no sample was specified.
+func (s *SampleSpec) Empty() bool {
+	return s.Percent == 0 && s.Count == 0
+}
+
+// size returns the number of clients to sample from numClients.
+func (s *SampleSpec) size(numClients int) int {
+	if s.Percent > 0 {
+		return int(math.Round(float64(numClients) * s.Percent / 100))
+	}
+	return int(min(s.Count, int64(numClients)))
+}
+
+// selecting returns true if any client selectors were specified.
+func (o *CliOpts) selecting() bool {
+	return len(o.Ids) > 0 || o.RegisteredOnly || o.ClientTypes != "" || !o.Sample.Empty()
+}
+
+// selectClients returns the ids of the clients to act upon, in ascending
+// order, being the specified ids, or the first NUM_CLIENTS clients,
+// filtered by the registration state and client type selectors, and then
+// randomly sampled.
+func selectClients(opts *CliOpts) (ids []clientstore.FileId, err error) {
+	if len(opts.Ids) > 0 {
+		ids = opts.Ids.ids()
+	} else {
+		ids = make([]clientstore.FileId, opts.NumClients)
+		for i := range ids {
+			ids[i] = clientstore.FileId(i)
+		}
+	}
+	numCandidates := len(ids)
+
+	if opts.RegisteredOnly {
+		if ids, err = selectRegistered(opts.clientStore, ids); err != nil {
+			return
+		}
+	}
+
+	if opts.ClientTypes != "" {
+		if ids, err = selectTypes(opts.clientStore, ids, strings.Split(opts.ClientTypes, ",")); err != nil {
+			return
+		}
+	}
+
+	if !opts.Sample.Empty() {
+		r := rand.New(rand.NewSource(opts.Seed))
+		ids = sampleIds(ids, opts.Sample.size(len(ids)), r)
+	}
+
+	if opts.selecting() {
+		log.Printf("Selected %d of %d candidate clients\n", len(ids), numCandidates)
+	}
+
+	return
+}
+
+// selectRegistered returns the candidates that are registered, merging
+// them with the ascending ids of the clients with registration info.
+func selectRegistered(clientStore *clientstore.ClientStore, candidates []clientstore.FileId) (ids []clientstore.FileId, err error) {
+	i := 0
+	err = clientStore.WalkFileIds(clientstore.REG_INFO_TYPE, func(id clientstore.FileId) error {
+		for i < len(candidates) && candidates[i] < id {
+			i++
+		}
+		if i < len(candidates) && candidates[i] == id {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to enumerate registered clients: %w",
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// selectTypes returns the candidates that are of one of the client types,
+// warning about any types that match none of the candidates.
+func selectTypes(clientStore *clientstore.ClientStore, candidates []clientstore.FileId, types []string) (ids []clientstore.FileId, err error) {
+	matched := make(map[string]bool)
+	for _, id := range candidates {
+		var clientInfo *clientstore.ClientInfo
+		if clientInfo, err = clientStore.ReadClientInfo(id); err != nil {
+			err = fmt.Errorf(
+				"failed to determine the type of client %d: %w",
+				id,
+				err,
+			)
+			return
+		}
+		if slices.Contains(types, clientInfo.Type) {
+			ids = append(ids, id)
+			matched[clientInfo.Type] = true
+		}
+	}
+
+	for _, clientType := range types {
+		if !matched[clientType] {
+			log.Printf("WARNING: No candidate clients are of type %q\n", clientType)
+		}
+	}
+
+	return
+}
+
+// sampleIds returns a random sample of size of the ids, in ascending order.
+func sampleIds(ids []clientstore.FileId, size int, r *rand.Rand) []clientstore.FileId {
+	// partially shuffle the ids, moving the sample to the front
+	for i := 0; i < size; i++ {
+		j := i + r.Intn(len(ids)-i)
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+
+	sample := ids[:size]
+	slices.Sort(sample)
+	return sample
+}
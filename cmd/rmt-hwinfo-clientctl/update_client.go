@@ -49,11 +49,34 @@ func updateClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 		return
 	}
 
+	// drift the client's hardware before sending the heartbeat, if requested
+	if cliOpts.DriftRate > 0 {
+		if _, err = maybeDriftSysInfo(id, sysInfo, cliOpts); err != nil {
+			err = fmt.Errorf(
+				"updateClient client %q failed to drift: %w",
+				hostname,
+				err,
+			)
+			return
+		}
+	}
+
 	// retrieve the client SCC creds
 	sccCreds := regInfo.SccCreds
 
+	// load the client's instance data
+	instData, err := loadClientInstData(id, cliOpts)
+	if err != nil {
+		err = fmt.Errorf(
+			"updateClient client %q failed to load instance data: %w",
+			hostname,
+			err,
+		)
+		return
+	}
+
 	// generate the client's extraData
-	systemProfiles, extraData := prepareExtraData(sysInfo, cliOpts)
+	systemProfiles, extraData := prepareExtraData(sysInfo, instData, cliOpts)
 
 	if cliOpts.SccHost != "" {
 		connectOpts.URL = cliOpts.SccHost
@@ -86,6 +109,7 @@ func updateClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 		trace("heartbeat failed as client %q not registered", hostname)
 		// delete the existing regInfo
 		_ = regInfo.Delete(id, cliOpts.clientStore)
+		_ = regInfo.Journal(id, clientstore.REG_STATE_UNREGISTERED, cliOpts.clientStore)
 
 		err = errors.New("failed to send keepalive heartbeat")
 		err = fmt.Errorf(
@@ -96,8 +120,12 @@ func updateClient(id clientstore.FileId, cliOpts *CliOpts) (err error) {
 		return
 	}
 
+	// journal the possibly refreshed credentials before saving them
 	regInfo.SccCreds = sccCreds
-	err = regInfo.Save(id, cliOpts.clientStore)
+	err = regInfo.Journal(id, clientstore.REG_STATE_REGISTERED, cliOpts.clientStore)
+	if err == nil {
+		err = regInfo.Save(id, cliOpts.clientStore)
+	}
 	if err != nil {
 		err = fmt.Errorf(
 			"updatedClient client %q failed to save updated registration info: %w",
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/client"
+)
+
+type CaptureOptions struct {
+	Root   string
+	Lspci  string
+	Name   string
+	Weight int
+	Arch   string
+	Output string
+}
+
+// map of Go arch names to the kernel arch names used by client types
+var goArches = map[string]string{
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// file holding the `lspci -vmm -nn` output in an alternate root directory
+const captureLspciFile = "lspci"
+
+// client type names are used in hostnames
+var invalidNameCharsRe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// default client type name, derived from the captured machine's hostname
+func captureName(root string) string {
+	name := "captured"
+	if hostname, err := os.ReadFile(filepath.Join(root, "etc", "hostname")); err == nil {
+		if h := strings.TrimSpace(string(hostname)); h != "" {
+			name, _, _ = strings.Cut(h, ".")
+		}
+	}
+	return strings.Trim(invalidNameCharsRe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// captureMain implements the capture command, which emits a catalog
+// containing a client type template for the local machine's hardware.
+func captureMain(args []string) {
+	var opts CaptureOptions
+
+	flags := flag.NewFlagSet("capture", flag.ExitOnError)
+	flags.StringVar(&opts.Root, "root", "/", "The `root` directory to read the proc files, and any lspci file, from, e.g. a fixture tree")
+	flags.StringVar(&opts.Lspci, "lspci", "", "Read the PCI devices from a `file` holding `lspci -vmm -nn` output, rather than running lspci, defaulting to the lspci file under an alternate root")
+	flags.StringVar(&opts.Name, "name", "", "The client type `name`, defaults to the captured machine's hostname")
+	flags.IntVar(&opts.Weight, "weight", 1, "The client type `weight`")
+	flags.StringVar(&opts.Arch, "arch", goArches[runtime.GOARCH], "The client type `arch`")
+	flags.StringVar(&opts.Output, "output", "", "Write the template to the specified `file` rather than stdout")
+	flags.Parse(args)
+
+	if opts.Name == "" {
+		opts.Name = captureName(opts.Root)
+	}
+	if opts.Arch == "" {
+		log.Fatalf("ERROR: Unable to determine the arch for %s, please specify one via --arch", runtime.GOARCH)
+	}
+
+	// running lspci would capture the local machine's PCI devices, rather
+	// than those of the machine whose files are under the alternate root
+	if opts.Lspci == "" && filepath.Clean(opts.Root) != "/" {
+		opts.Lspci = filepath.Join(opts.Root, captureLspciFile)
+	}
+
+	var lspci []byte
+	var err error
+	if opts.Lspci != "" {
+		lspci, err = os.ReadFile(opts.Lspci)
+	} else {
+		lspci, err = exec.Command("lspci", "-vmm", "-nn").Output()
+	}
+	if err != nil {
+		log.Fatalf("ERROR: Failed to retrieve lspci output: %s", err.Error())
+	}
+
+	cat, err := client.Capture(&client.CaptureOpts{
+		Name:   opts.Name,
+		Weight: opts.Weight,
+		Arch:   opts.Arch,
+		Root:   opts.Root,
+		Lspci:  lspci,
+	})
+	if err != nil {
+		log.Fatalf("ERROR: Failed to capture hardware under %q: %s", opts.Root, err.Error())
+	}
+
+	catData, err := json.MarshalIndent(cat, "", "  ")
+	if err != nil {
+		log.Fatalf("ERROR: Failed to marshal captured client type template: %s", err.Error())
+	}
+	catData = append(catData, '\n')
+
+	if opts.Output == "" {
+		os.Stdout.Write(catData)
+		return
+	}
+
+	if err := os.WriteFile(opts.Output, catData, 0o644); err != nil {
+		log.Fatalf("ERROR: Failed to write client type template to %q: %s", opts.Output, err.Error())
+	}
+	log.Printf("Captured client type %q to %q\n", opts.Name, opts.Output)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+)
+
+type CompactOptions struct {
+	DataStore string
+}
+
+// compactMain implements the compact command, which reclaims the space
+// used by the superseded and deleted client files retained in the pack of
+// a pack backend datastore.
+func compactMain(args []string) {
+	var opts CompactOptions
+
+	flags := flag.NewFlagSet("compact", flag.ExitOnError)
+	flags.StringVar(&opts.DataStore, "datastore", option_defaults.DataStore, "Location of the pack backend `datastore` to compact")
+	flags.Parse(args)
+
+	if fi, err := os.Stat(opts.DataStore); err != nil || !fi.IsDir() {
+		log.Fatalf("ERROR: Datastore %q doesn't exist\n", opts.DataStore)
+	}
+
+	dataStore := clientstore.New(opts.DataStore)
+	if err := dataStore.Lock(clientstore.LOCK_EXCLUSIVE, strings.Join(os.Args, " ")); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	// the pack backend was introduced after the manifest
+	manifest, err := dataStore.ReadManifest()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Fatalf("ERROR: Datastore %q has no manifest, so doesn't use the %s backend\n", opts.DataStore, clientstore.BACKEND_PACK)
+	case err != nil:
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+	if err = manifest.Validate(); err == nil {
+		err = manifest.CheckBackend(clientstore.BACKEND_PACK)
+	}
+	if err != nil {
+		log.Fatalf("ERROR: Can't compact %q: %s", opts.DataStore, err.Error())
+	}
+
+	if err = dataStore.UseBackend(clientstore.BACKEND_PACK); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	log.Printf("Compacting %q\n", opts.DataStore)
+	before, after, err := dataStore.Compact()
+	if err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	if err = dataStore.Close(); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	log.Printf(
+		"Compacted the pack of %q from %d bytes to %d bytes, reclaiming %d bytes\n",
+		opts.DataStore,
+		before,
+		after,
+		before-after,
+	)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
+)
+
+type ConvertOptions struct {
+	DataStore     string
+	Backend       string
+	Output        string
+	OutputBackend string
+	Compress      bool
+}
+
+// convertMain implements the convert command, which copies the clients of
+// a datastore to a new datastore using a different backend, along with
+// its stats, journal and manifest.
+func convertMain(args []string) {
+	var opts ConvertOptions
+
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	flags.StringVar(&opts.DataStore, "datastore", option_defaults.DataStore, "Location of the `datastore` to convert")
+	flags.StringVar(&opts.Backend, "backend", "", "The `backend` of the datastore to convert, defaults to that recorded in its manifest, or dir")
+	flags.StringVar(&opts.Output, "output", "", "Location of the converted `datastore`, which must not already exist")
+	flags.StringVar(&opts.OutputBackend, "output-backend", clientstore.BACKEND_PACK, "The `backend` of the converted datastore")
+	flags.BoolVar(&opts.Compress, "compress", false, "Store the converted clients' files gzip compressed, defaults to the compression recorded in the manifest")
+	flags.Parse(args)
+
+	specified := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		specified[f.Name] = true
+	})
+
+	if opts.Output == "" {
+		log.Fatal("ERROR: The converted datastore must be specified via --output\n")
+	}
+	if fi, err := os.Stat(opts.DataStore); err != nil || !fi.IsDir() {
+		log.Fatalf("ERROR: Datastore %q doesn't exist\n", opts.DataStore)
+	}
+	if _, err := os.Stat(opts.Output); !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("ERROR: Converted datastore %q already exists\n", opts.Output)
+	}
+
+	src := clientstore.New(opts.DataStore)
+	if err := src.Lock(clientstore.LOCK_SHARED, strings.Join(os.Args, " ")); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	// datastores generated by older versions may not have a manifest
+	manifest, err := src.ReadManifest()
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		manifest = nil
+	case err != nil:
+		log.Fatalf("ERROR: %s", err.Error())
+	default:
+		if err = manifest.Validate(); err != nil {
+			log.Fatalf("ERROR: Can't convert %q: %s", opts.DataStore, err.Error())
+		}
+	}
+
+	if opts.Backend == "" {
+		opts.Backend = clientstore.BACKEND_DIR
+		if manifest != nil {
+			opts.Backend = manifest.BackendName()
+		}
+	}
+	if err := src.UseBackend(opts.Backend); err != nil {
+		log.Fatalf("ERROR: Invalid --backend: %s", err.Error())
+	}
+	if err := clientstore.ValidateBackend(opts.OutputBackend); err != nil {
+		log.Fatalf("ERROR: Invalid --output-backend: %s", err.Error())
+	}
+
+	dst, err := clientstore.NewWithBackend(opts.Output, opts.OutputBackend)
+	if err == nil {
+		err = dst.Lock(clientstore.LOCK_EXCLUSIVE, strings.Join(os.Args, " "))
+	}
+	if err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	// the converted datastore is synced once complete, when it is closed
+	dst.SetSync(false)
+
+	if manifest != nil && !specified["compress"] {
+		opts.Compress = manifest.Compression != ""
+	}
+	dst.SetCompression(opts.Compress)
+
+	log.Printf(
+		"Converting %q from the %s backend to %q using the %s backend\n",
+		opts.DataStore,
+		opts.Backend,
+		opts.Output,
+		opts.OutputBackend,
+	)
+
+	var numFiles, numBytes int64
+	var numClients int64
+	lastId := clientstore.FileId(0)
+	err = src.Walk(func(id clientstore.FileId, fileType clientstore.FileType) (err error) {
+		data, err := src.ReadFile(id, fileType)
+		if err != nil {
+			return
+		}
+		if err = dst.WriteFile(id, fileType, data, 0o644); err != nil {
+			return
+		}
+
+		if numFiles == 0 || id != lastId {
+			numClients++
+			lastId = id
+		}
+		numFiles++
+		numBytes += int64(len(data))
+		return
+	})
+	if err != nil {
+		log.Fatalf("ERROR: Failed to convert %q: %s", opts.DataStore, err.Error())
+	}
+
+	// the stats are copied as is, as they describe the same clients
+	if stats, err := os.ReadFile(hwInfoStatsPath(opts.DataStore)); err == nil {
+		if err = os.WriteFile(hwInfoStatsPath(opts.Output), stats, 0o644); err != nil {
+			log.Fatalf("ERROR: Failed to copy client stats to %q: %s", opts.Output, err.Error())
+		}
+	}
+
+	// the journal holds the clients' registration history used by recover
+	if err := dst.CopyJournal(src); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	if manifest != nil {
+		manifest.SchemaVersion = clientstore.MANIFEST_SCHEMA_VERSION
+		manifest.UpdatedAt = time.Now().UTC()
+		manifest.Backend = dst.Backend()
+		manifest.Compression = dst.Compression()
+		if err := dst.WriteManifest(manifest); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+	}
+
+	if err := src.Close(); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+	if err := dst.Close(); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	_, storedBytes := dst.WriteSizes()
+	log.Printf(
+		"Converted %d files, totalling %d bytes, stored as %d bytes, for %d clients to %q\n",
+		numFiles,
+		numBytes,
+		storedBytes,
+		numClients,
+		opts.Output,
+	)
+}
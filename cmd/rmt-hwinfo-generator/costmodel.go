@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// encodings of the profile data column
+const (
+	ENCODING_RAW  = "raw"  // the profile data as is
+	ENCODING_JSON = "json" // the JSON encoded profile data
+)
+
+// CostModel specifies how the database storage sizes of the data profiles,
+// and of the system information they are extracted from, are estimated.
+type CostModel struct {
+	// approx size of the primary key id field
+	PrimaryKeySize int `json:"primaryKeySize"`
+
+	// approx size of the three timestamp fields, createdAt, updatedAt
+	// and lastSeen
+	TimestampsSize int `json:"timestampsSize"`
+
+	// per row storage overhead, e.g. row headers and page slack
+	RowOverhead int `json:"rowOverhead"`
+
+	// size of the length prefix of each variable length column
+	LengthPrefixSize int `json:"lengthPrefixSize"`
+
+	// per row overhead of the profile type and identifier unique index,
+	// with the indexed key columns and primary key included if specified
+	IndexEntryOverhead int  `json:"indexEntryOverhead"`
+	IndexIncludesKey   bool `json:"indexIncludesKey"`
+
+	// encoding of the stored profile data
+	DataEncoding string `json:"dataEncoding"`
+
+	// ratio of the compressed to the uncompressed size of the profile data
+	// and system information columns
+	CompressionFactor float64 `json:"compressionFactor"`
+}
+
+// DefaultCostModel matches the original fixed size estimates.
+var DefaultCostModel = CostModel{
+	PrimaryKeySize:    8,
+	TimestampsSize:    18,
+	DataEncoding:      ENCODING_RAW,
+	CompressionFactor: 1.0,
+}
+
+// LoadCostModel loads a JSON cost model, with any unspecified settings
+// retaining their default values.
+func LoadCostModel(path string) (cm CostModel, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to read cost model %q: %w",
+			path,
+			err,
+		)
+		return
+	}
+
+	cm = DefaultCostModel
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&cm); err != nil {
+		err = fmt.Errorf(
+			"failed to parse cost model %q: %w",
+			path,
+			err,
+		)
+		return
+	}
+
+	if err = cm.Validate(); err != nil {
+		err = fmt.Errorf(
+			"invalid cost model %q: %w",
+			path,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+func (cm *CostModel) Validate() (err error) {
+	sizes := []struct {
+		name  string
+		value int
+	}{
+		{"primaryKeySize", cm.PrimaryKeySize},
+		{"timestampsSize", cm.TimestampsSize},
+		{"rowOverhead", cm.RowOverhead},
+		{"lengthPrefixSize", cm.LengthPrefixSize},
+		{"indexEntryOverhead", cm.IndexEntryOverhead},
+	}
+	for _, size := range sizes {
+		if size.value < 0 {
+			err = fmt.Errorf("%s must not be negative", size.name)
+			return
+		}
+	}
+
+	switch cm.DataEncoding {
+	case ENCODING_RAW, ENCODING_JSON:
+	default:
+		err = fmt.Errorf(
+			"unsupported dataEncoding %q, must be %q or %q",
+			cm.DataEncoding,
+			ENCODING_RAW,
+			ENCODING_JSON,
+		)
+		return
+	}
+
+	if cm.CompressionFactor <= 0 || cm.CompressionFactor > 1 {
+		err = fmt.Errorf("compressionFactor must be greater than 0 and at most 1")
+		return
+	}
+
+	return
+}
+
+// ProfileRowSize estimates the storage size of a data profile's row.
+func (cm *CostModel) ProfileRowSize(typeName, pId string, pStats ProfileInfoStats) float64 {
+	dataSize := pStats.Size
+	if cm.DataEncoding == ENCODING_JSON {
+		dataSize = pStats.JsonSize
+	}
+
+	size := float64(cm.PrimaryKeySize +
+		cm.TimestampsSize +
+		cm.RowOverhead +
+		len(typeName) + cm.LengthPrefixSize +
+		len(pId) + cm.LengthPrefixSize +
+		cm.IndexEntryOverhead)
+	size += float64(dataSize+cm.LengthPrefixSize) * cm.CompressionFactor
+
+	if cm.IndexIncludesKey {
+		size += float64(len(typeName) + len(pId) + cm.PrimaryKeySize)
+	}
+
+	return size
+}
+
+// HwInfoSavings estimates the system information storage saved by not
+// storing a data profile's data in the clients' system information.
+func (cm *CostModel) HwInfoSavings(pStats ProfileInfoStats) float64 {
+	return float64((pStats.Count-1)*pStats.JsonSize) * cm.CompressionFactor
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Distribution summarises the distribution of a set of integer values,
+// such as payload sizes or device counts. The values are retained as a
+// histogram of value counts, allowing the summary to be recomputed when
+// more values are added, e.g. when appending clients to a datastore.
+type Distribution struct {
+	Count     int64         `json:"count"`
+	Min       int           `json:"min"`
+	Max       int           `json:"max"`
+	Mean      float64       `json:"mean"`
+	StdDev    float64       `json:"stdDev"`
+	P50       int           `json:"p50"`
+	P95       int           `json:"p95"`
+	P99       int           `json:"p99"`
+	Histogram map[int]int64 `json:"histogram"`
+}
+
+func (d *Distribution) Add(value int) {
+	if d.Histogram == nil {
+		d.Histogram = make(map[int]int64)
+	}
+	d.Histogram[value]++
+}
+
+// Reset discards the distribution's values.
+func (d *Distribution) Reset() {
+	*d = Distribution{}
+}
+
+// Finalize recomputes the summary values from the histogram, using the
+// nearest rank method for the percentiles.
+func (d *Distribution) Finalize() {
+	values := make([]int, 0, len(d.Histogram))
+	for value := range d.Histogram {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+
+	histogram := d.Histogram
+	d.Reset()
+	d.Histogram = histogram
+	if len(values) == 0 {
+		return
+	}
+
+	var total float64
+	for _, value := range values {
+		d.Count += d.Histogram[value]
+		total += float64(value) * float64(d.Histogram[value])
+	}
+	d.Min = values[0]
+	d.Max = values[len(values)-1]
+	d.Mean = total / float64(d.Count)
+
+	var sumSquares float64
+	for _, value := range values {
+		delta := float64(value) - d.Mean
+		sumSquares += delta * delta * float64(d.Histogram[value])
+	}
+	d.StdDev = math.Sqrt(sumSquares / float64(d.Count))
+
+	percentiles := []struct {
+		field    *int
+		fraction float64
+	}{
+		{&d.P50, 0.50},
+		{&d.P95, 0.95},
+		{&d.P99, 0.99},
+	}
+	for _, p := range percentiles {
+		rank := int64(math.Ceil(p.fraction * float64(d.Count)))
+		var seen int64
+		for _, value := range values {
+			seen += d.Histogram[value]
+			if seen >= rank {
+				*p.field = value
+				break
+			}
+		}
+	}
+}
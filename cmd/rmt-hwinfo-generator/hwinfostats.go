@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rtamalin/rmt-client-testing/internal/client"
+	"github.com/rtamalin/rmt-client-testing/internal/profile"
+)
+
+type ProfileInfoStatBlock struct {
+	Size     int `json:"size"`
+	JsonSize int `json:"jsonSize"`
+	Count    int `json:"count"`
+}
+
+type ProfileInfoStats *ProfileInfoStatBlock
+
+func NewProfileKeyStats(pInfo *profile.ProfileInfo) ProfileInfoStats {
+	p := new(ProfileInfoStatBlock)
+
+	// init to 0, will be incremented later
+	p.Count = 0
+
+	// determine the storage size for storing the profile's data, which
+	// should be JSON encoded string...
+	switch v := pInfo.Data.(type) {
+	case []string:
+		p.Size = len(strings.Join(v, "\n"))
+	case string:
+		p.Size = len(v)
+	default:
+		log.Fatalf("ERROR: Unsupported profile data type %T for %v", v, v)
+	}
+
+	infoMap := map[string]any{
+		"identifier": pInfo.Identifier,
+		"data":       pInfo.Data,
+	}
+
+	withData, _ := json.Marshal(infoMap)
+
+	delete(infoMap, "data")
+	withoutData, _ := json.Marshal(infoMap)
+
+	p.JsonSize = len(withData) - len(withoutData)
+
+	return p
+}
+
+// ClientDistributions holds the distributions of the sizes of the clients'
+// system information JSON blobs, with and without their data profiles,
+// and of the clients' device counts.
+type ClientDistributions struct {
+	SysInfoSize     Distribution `json:"sysInfoSize"`
+	BaseSysInfoSize Distribution `json:"baseSysInfoSize"`
+	Disks           Distribution `json:"disks"`
+	GPUs            Distribution `json:"gpus"`
+	Nets            Distribution `json:"nets"`
+	Cpus            Distribution `json:"cpus"`
+	Memory          Distribution `json:"memory"`
+	Sockets         Distribution `json:"sockets"`
+}
+
+func (cd *ClientDistributions) Add(c *client.Client, sysInfoSize, baseSysInfoSize int) {
+	cd.SysInfoSize.Add(sysInfoSize)
+	cd.BaseSysInfoSize.Add(baseSysInfoSize)
+	cd.Disks.Add(c.NumDisk)
+	cd.GPUs.Add(c.NumGPU)
+	cd.Nets.Add(c.NumNet)
+	cd.Cpus.Add(c.Cpus)
+	cd.Memory.Add(c.Memory)
+	cd.Sockets.Add(c.Sockets)
+}
+
+func (cd *ClientDistributions) Finalize() {
+	cd.SysInfoSize.Finalize()
+	cd.BaseSysInfoSize.Finalize()
+	cd.Disks.Finalize()
+	cd.GPUs.Finalize()
+	cd.Nets.Finalize()
+	cd.Cpus.Finalize()
+	cd.Memory.Finalize()
+	cd.Sockets.Finalize()
+}
+
+type ProfileShare struct {
+	Identifier string `json:"identifier"`
+	Count      int    `json:"count"`
+}
+
+// ProfileSharing summarises how many clients share each of the unique
+// profiles of a given profile type.
+type ProfileSharing struct {
+	Singletons        int            `json:"singletons"`
+	ClientsPerProfile Distribution   `json:"clientsPerProfile"`
+	Top               []ProfileShare `json:"top"`
+}
+
+func NewProfileSharing(typeMap map[string]ProfileInfoStats, topN int) *ProfileSharing {
+	ps := new(ProfileSharing)
+
+	shares := make([]ProfileShare, 0, len(typeMap))
+	for pId, pStats := range typeMap {
+		shares = append(shares, ProfileShare{Identifier: pId, Count: pStats.Count})
+		ps.ClientsPerProfile.Add(pStats.Count)
+		if pStats.Count == 1 {
+			ps.Singletons++
+		}
+	}
+	ps.ClientsPerProfile.Finalize()
+
+	// most shared first, ordering equally shared profiles by identifier
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Count != shares[j].Count {
+			return shares[i].Count > shares[j].Count
+		}
+		return shares[i].Identifier < shares[j].Identifier
+	})
+	ps.Top = shares[:min(topN, len(shares))]
+
+	return ps
+}
+
+type HwInfoStats struct {
+	Seed                 int64                                  `json:"seed"`
+	NumClients           int64                                  `json:"numClients"`
+	TypeMix              map[string]int                         `json:"typeMix"`
+	TypeCounts           map[string]int                         `json:"typeCounts"`
+	ProviderMix          map[string]int                         `json:"providerMix"`
+	ProviderCounts       map[string]int                         `json:"providerCounts"`
+	ProductMix           map[string]int                         `json:"productMix"`
+	ProductCounts        map[string]int                         `json:"productCounts"`
+	PciFormatMix         map[string]int                         `json:"pciFormatMix"`
+	PciFormatCounts      map[string]int                         `json:"pciFormatCounts"`
+	ExtensionSetCounts   map[string]int                         `json:"extensionSetCounts"`
+	InstanceDataClients  int64                                  `json:"instanceDataClients"`
+	Diversity            client.Diversity                       `json:"diversity"`
+	UniqueProfilesTarget int64                                  `json:"uniqueProfilesTarget"`
+	ProfileTypes         []string                               `json:"profileTypes"`
+	ProfileStats         map[string]map[string]ProfileInfoStats `json:"profileStats"`
+	CostModel            CostModel                              `json:"costModel"`
+	NumProfileTypes      int                                    `json:"numProfileTypes"`
+	NumUniqueProfiles    int                                    `json:"numUniqueProfiles"`
+	ProfileStorageSize   int                                    `json:"profileStorageSize"`
+	HwInfoSavings        int                                    `json:"hwInfoSavings"`
+	DbNetSavings         int                                    `json:"dbNetSavings"`
+	Distributions        ClientDistributions                    `json:"distributions"`
+	TypeDistributions    map[string]*ClientDistributions        `json:"typeDistributions"`
+	TopProfiles          int                                    `json:"topProfiles"`
+	ProfileSharing       map[string]*ProfileSharing             `json:"profileSharing"`
+	Projection           *Projection                            `json:"projection,omitempty"`
+	StoredSize           *StoredSize                            `json:"storedSize,omitempty"`
+
+	// serialises updates from parallel generation jobs
+	mutex sync.Mutex
+}
+
+// StoredSize compares the logical size of the generated client files with
+// their size as stored in the datastore, which is smaller if compressed.
+type StoredSize struct {
+	LogicalBytes int64   `json:"logicalBytes"`
+	StoredBytes  int64   `json:"storedBytes"`
+	Ratio        float64 `json:"ratio"` // of the stored to the logical size
+}
+
+// AddStoredSize adds the sizes of the client files written to the
+// datastore to those of any previously generated clients.
+func (h *HwInfoStats) AddStoredSize(logical, stored int64) {
+	if h.StoredSize == nil {
+		h.StoredSize = new(StoredSize)
+	}
+	h.StoredSize.LogicalBytes += logical
+	h.StoredSize.StoredBytes += stored
+	if h.StoredSize.LogicalBytes > 0 {
+		h.StoredSize.Ratio = float64(h.StoredSize.StoredBytes) / float64(h.StoredSize.LogicalBytes)
+	}
+}
+
+func NewHwInfoStats() *HwInfoStats {
+	h := new(HwInfoStats)
+	h.Init()
+	return h
+}
+
+func (h *HwInfoStats) Init() {
+	h.TypeCounts = make(map[string]int)
+	h.ProviderCounts = make(map[string]int)
+	h.ProductCounts = make(map[string]int)
+	h.PciFormatCounts = make(map[string]int)
+	h.ExtensionSetCounts = make(map[string]int)
+	h.ProfileStats = make(map[string]map[string]ProfileInfoStats)
+	h.TypeDistributions = make(map[string]*ClientDistributions)
+	h.ProfileSharing = make(map[string]*ProfileSharing)
+}
+
+func (h *HwInfoStats) AddClient(c *client.Client, sysInfo string) {
+	baseSysInfoSize := len(c.BaseSystemInfo())
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.NumClients++
+	h.TypeCounts[c.Type.Name]++
+	h.ProviderCounts[c.Provider.String()]++
+	h.PciFormatCounts[c.PciFormat]++
+	if c.Product != nil {
+		h.ProductCounts[c.Product.Name]++
+	}
+	if c.ExtensionSet != "" {
+		h.ExtensionSetCounts[c.ExtensionSet]++
+	}
+	if c.InstanceData != "" {
+		h.InstanceDataClients++
+	}
+
+	if _, exists := h.TypeDistributions[c.Type.Name]; !exists {
+		h.TypeDistributions[c.Type.Name] = new(ClientDistributions)
+	}
+	h.TypeDistributions[c.Type.Name].Add(c, len(sysInfo), baseSysInfoSize)
+	h.Distributions.Add(c, len(sysInfo), baseSysInfoSize)
+
+	for profileName, pInfo := range c.Profiles {
+		h.add(profileName, pInfo)
+	}
+}
+
+func (h *HwInfoStats) Add(profileName string, pInfo *profile.ProfileInfo) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.add(profileName, pInfo)
+}
+
+func (h *HwInfoStats) add(profileName string, pInfo *profile.ProfileInfo) {
+	// add an entry for the profile if not seen before
+	if _, exists := h.ProfileStats[profileName]; !exists {
+		h.ProfileStats[profileName] = make(map[string]ProfileInfoStats)
+	}
+	if _, exists := h.ProfileStats[profileName][pInfo.Identifier]; !exists {
+		h.ProfileStats[profileName][pInfo.Identifier] = NewProfileKeyStats(pInfo)
+	}
+
+	h.ProfileStats[profileName][pInfo.Identifier].Count++
+}
+
+func (h *HwInfoStats) Finalize() {
+	h.NumProfileTypes = len(h.ProfileStats)
+	h.NumUniqueProfiles = 0
+	h.ProfileStorageSize = 0
+	h.HwInfoSavings = 0
+	var profileStorageSize, hwInfoSavings float64
+	for typeName, typeMap := range h.ProfileStats {
+		h.NumUniqueProfiles += len(typeMap)
+		for pId, pStats := range typeMap {
+			// add the approx size to store the data profile entry itself
+			profileStorageSize += h.CostModel.ProfileRowSize(typeName, pId, pStats)
+
+			// calculate the savings gained by not storing the profile data
+			// in the hwinfo JSON blob.
+			hwInfoSavings += h.CostModel.HwInfoSavings(pStats)
+		}
+	}
+	h.ProfileStorageSize = int(math.Round(profileStorageSize))
+	h.HwInfoSavings = int(math.Round(hwInfoSavings))
+	h.DbNetSavings = h.HwInfoSavings - h.ProfileStorageSize
+
+	h.Distributions.Finalize()
+	for _, cd := range h.TypeDistributions {
+		cd.Finalize()
+	}
+
+	h.ProfileSharing = make(map[string]*ProfileSharing, len(h.ProfileStats))
+	for typeName, typeMap := range h.ProfileStats {
+		h.ProfileSharing[typeName] = NewProfileSharing(typeMap, h.TopProfiles)
+	}
+}
+
+func hwInfoStatsPath(dsDir string) string {
+	return filepath.Join(dsDir, "HwInfoStats.json")
+}
+
+// LoadHwInfoStats loads the stats previously recorded for the clients in
+// the datastore, so that additional clients can be merged into them.
+func LoadHwInfoStats(dsDir string) (h *HwInfoStats, err error) {
+	filePath := hwInfoStatsPath(dsDir)
+
+	hwisData, err := os.ReadFile(filePath)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to read HwInfoStats from %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+
+	h = NewHwInfoStats()
+	err = json.Unmarshal(hwisData, h)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to json.Unmarshal() HwInfoStats from %q: %w",
+			filePath,
+			err,
+		)
+		h = nil
+		return
+	}
+
+	// stats recorded before the client total was tracked
+	if h.NumClients == 0 {
+		for _, count := range h.TypeCounts {
+			h.NumClients += int64(count)
+		}
+	}
+
+	return
+}
+
+func (h *HwInfoStats) Write(dsDir string) (err error) {
+	return h.WriteFile(hwInfoStatsPath(dsDir))
+}
+
+func (h *HwInfoStats) WriteFile(filePath string) (err error) {
+	hwisData, err := json.Marshal(h)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to json.Marshall() HwInfoStats: %w",
+			err,
+		)
+		return
+	}
+
+	err = os.WriteFile(filePath, hwisData, 0o644)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to write HwInfoStats to %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+
+	return
+}
@@ -1,205 +1,636 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"math"
 	"os"
-	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/rtamalin/rmt-client-testing/internal/client"
 	"github.com/rtamalin/rmt-client-testing/internal/clientstore"
-	"github.com/rtamalin/rmt-client-testing/internal/profile"
+	"github.com/rtamalin/rmt-client-testing/internal/workqueue"
 )
 
 const (
-	CREATE = true
+	AppName    = "rmt-hwinfo-generator"
+	AppVersion = "1.0"
+	CREATE     = true
 )
 
 type Options struct {
-	NumClients int64
-	DataStore  string
+	NumClients     int64
+	NumJobs        int64
+	Append         bool
+	StartId        int64
+	DataStore      string
+	Backend        string
+	Compress       bool
+	Catalog        string
+	AddTypes       PathList
+	Seed           int64
+	Mix            MixSpec
+	Choices        ChoiceOverrides
+	Providers      MixSpec
+	Products       MixSpec
+	PciFormats     MixSpec
+	Diversity      client.Diversity
+	UniqueProfiles int64
+	Profiles       string
+	TopProfiles    int
+	CostModel      string
+	StatsOnly      bool
+	StatsFile      string
+	Project        int64
 }
 
 var option_defaults = Options{
-	DataStore:  "ClientDataStore",
-	NumClients: 1000,
+	DataStore:   "ClientDataStore",
+	Backend:     clientstore.BACKEND_DIR,
+	NumClients:  1000,
+	NumJobs:     int64(runtime.NumCPU()),
+	TopProfiles: 10,
+	StatsFile:   "HwInfoStats.json",
 }
 
 var options Options
 
-type ProfileInfoStatBlock struct {
-	Size     int `json:"size"`
-	JsonSize int `json:"jsonSize"`
-	Count    int `json:"count"`
-}
+func main() {
+	// handle subcommands
+	if len(os.Args) > 1 && os.Args[1] == "capture" {
+		captureMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		convertMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compact" {
+		compactMain(os.Args[2:])
+		return
+	}
 
-type ProfileInfoStats *ProfileInfoStatBlock
+	options = option_defaults
+	flag.StringVar(&options.DataStore, "datastore", option_defaults.DataStore, "Location of `datastore` to store simulated clients")
+	flag.StringVar(&options.Backend, "backend", option_defaults.Backend, "The datastore `backend` used to store the simulated clients, either dir or pack")
+	flag.BoolVar(&options.Compress, "compress", option_defaults.Compress, "Store the simulated clients' files gzip compressed, when that reduces their size")
+	flag.Int64Var(&options.NumClients, "clients", option_defaults.NumClients, "The number of `clients` to simulate")
+	flag.BoolVar(&options.Append, "append", option_defaults.Append, "Append the clients to an existing datastore, following its highest client id, and merge them into its stats")
+	flag.Int64Var(&options.StartId, "start-id", option_defaults.StartId, "The client `id` to start appending clients from, defaults to the id following the highest existing client id")
+	flag.Int64Var(&options.NumJobs, "jobs", option_defaults.NumJobs, "The number of parallel `jobs` used to generate clients")
+	flag.StringVar(&options.Catalog, "catalog", option_defaults.Catalog, "JSON `catalog` of client types to simulate, defaults to the built-in catalog")
+	flag.Var(&options.AddTypes, "add-types", "Add the client types from a JSON `catalog`, e.g. a captured template, to the catalog, can be repeated")
+	flag.Int64Var(&options.Seed, "seed", option_defaults.Seed, "The `seed` used to generate reproducible clients, defaults to a random seed")
+	flag.Var(&options.Mix, "mix", "Client type `mix` as a comma separated list of TYPE=WEIGHT entries, e.g. tiny=60,small=25,metal=1")
+	flag.Var(&options.Choices, "choices", "Override a client type's disks, gpus, nets, cpus, memory or sockets choice table with `TYPE.TABLE=VALUE:WEIGHT,...`, can be repeated")
+	flag.Var(&options.Providers, "providers", "Provider `mix` as a comma separated list of PROVIDER=WEIGHT entries, e.g. amazon=50,azure=30,google=20")
+	flag.Var(&options.Products, "products", "Base product `mix` as a comma separated list of PRODUCT=WEIGHT entries, e.g. sles-15.7=70,sles-15.6=20,sl-micro-6.1=10")
+	flag.Var(&options.PciFormats, "pci-formats", "pci_data format `mix` as a comma separated list of FORMAT=WEIGHT entries, using lspci, lspci-n, lspci-nn or lspci-vmm formats")
+	flag.Float64Var(&options.Diversity.ModAddProb, "mod-add-prob", 0, "The `probability` of adding each of the catalog's optional modules to a client")
+	flag.Float64Var(&options.Diversity.ModDropProb, "mod-drop-prob", 0, "The `probability` of dropping each of a client's standard modules")
+	flag.Float64Var(&options.Diversity.DeviceAddProb, "device-add-prob", 0, "The `probability` of adding each of the catalog's optional PCI devices to a client")
+	flag.Int64Var(&options.UniqueProfiles, "unique-profiles", 0, "The target `number` of unique data profiles to steer the generated profile diversity towards")
+	flag.StringVar(&options.Profiles, "profiles", strings.Join(client.ProfileTypes(), ","), "Comma separated list of data profile `types` to generate, from: "+strings.Join(client.ProfileTypeNames(), ","))
+	flag.IntVar(&options.TopProfiles, "top-profiles", option_defaults.TopProfiles, "The `number` of most shared profiles of each type to report in the stats")
+	flag.StringVar(&options.CostModel, "cost-model", option_defaults.CostModel, "JSON `file` specifying the database storage cost model used to estimate the profile storage sizes and savings")
+	flag.BoolVar(&options.StatsOnly, "stats-only", option_defaults.StatsOnly, "Only generate the stats for the simulated clients, without writing them to a datastore")
+	flag.StringVar(&options.StatsFile, "stats-file", option_defaults.StatsFile, "The `file` to write the stats to when using --stats-only")
+	flag.Int64Var(&options.Project, "project", option_defaults.Project, "Project the stats of the simulated clients to this `number` of clients")
+	flag.Parse()
 
-func NewProfileKeyStats(pInfo *profile.ProfileInfo) ProfileInfoStats {
-	p := new(ProfileInfoStatBlock)
+	specified := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		specified[f.Name] = true
+	})
 
-	// init to 0, will be incremented later
-	p.Count = 0
+	if options.StatsOnly && options.Append {
+		log.Fatal("ERROR: The --stats-only and --append options can't be used together\n")
+	}
 
-	// determine the storage size for storing the profile's data, which
-	// should be JSON encoded string...
-	switch v := pInfo.Data.(type) {
-	case []string:
-		p.Size = len(strings.Join(v, "\n"))
-	case string:
-		p.Size = len(v)
-	default:
-		log.Fatalf("ERROR: Unsupported profile data type %T for %v", v, v)
+	if specified["start-id"] && !options.Append {
+		log.Fatal("ERROR: The --start-id option can only be used with --append\n")
 	}
 
-	infoMap := map[string]any{
-		"identifier": pInfo.Identifier,
-		"data":       pInfo.Data,
+	if err := clientstore.ValidateBackend(options.Backend); err != nil {
+		log.Fatalf("ERROR: Invalid --backend: %s", err.Error())
 	}
 
-	withData, _ := json.Marshal(infoMap)
+	if (options.NumClients >= math.MaxUint32) || (options.NumClients < 0) {
+		log.Fatal(
+			"ERROR: The number of clients must be a positive value between 0 and MaxUint32\n",
+		)
+	}
 
-	delete(infoMap, "data")
-	withoutData, _ := json.Marshal(infoMap)
+	if (options.StartId >= math.MaxUint32) || (options.StartId < 0) {
+		log.Fatal(
+			"ERROR: The start client id must be a positive value between 0 and MaxUint32\n",
+		)
+	}
 
-	p.JsonSize = len(withData) - len(withoutData)
+	if (options.NumJobs >= math.MaxUint32) || (options.NumJobs < 1) {
+		log.Fatal(
+			"ERROR: The number of parallel jobs must be a positive value between 1 and MaxUint32\n",
+		)
+	}
 
-	return p
-}
+	costModel := DefaultCostModel
+	if options.CostModel != "" {
+		var err error
+		if costModel, err = LoadCostModel(options.CostModel); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+		log.Printf("Using cost model %+v from %q\n", costModel, options.CostModel)
+	}
 
-type HwInfoStats struct {
-	ProfileStats       map[string]map[string]ProfileInfoStats `json:"profileStats"`
-	NumProfileTypes    int                                    `json:"numProfileTypes"`
-	NumUniqueProfiles  int                                    `json:"numUniqueProfiles"`
-	ProfileStorageSize int                                    `json:"profileStorageSize"`
-	HwInfoSavings      int                                    `json:"hwInfoSavings"`
-	DbNetSavings       int                                    `json:"dbNetSavings"`
-}
+	if options.TopProfiles < 0 {
+		log.Fatal("ERROR: The number of top profiles must not be negative\n")
+	}
 
-func NewHwInfoStats() *HwInfoStats {
-	h := new(HwInfoStats)
-	h.Init()
-	return h
-}
+	if options.Catalog != "" {
+		cat, err := client.LoadCatalog(options.Catalog)
+		if err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+		client.SetCatalog(cat)
+		log.Printf("Using client types %v from catalog %q\n", cat.TypeNames(), options.Catalog)
+	}
 
-func (h *HwInfoStats) Init() {
-	h.ProfileStats = make(map[string]map[string]ProfileInfoStats)
-}
+	catalog := client.ActiveCatalog()
+	for _, catalogPath := range options.AddTypes {
+		if err := catalog.LoadCatalogTypes(catalogPath); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+		log.Printf("Added client types from catalog %q\n", catalogPath)
+	}
+	if options.Mix != nil {
+		if err := catalog.ApplyMix(options.Mix); err != nil {
+			log.Fatalf("ERROR: Invalid --mix %q: %s", options.Mix.String(), err.Error())
+		}
+	}
+	for _, override := range options.Choices {
+		err := catalog.SetCountChoices(override.TypeName, override.TableName, override.Choices)
+		if err != nil {
+			log.Fatalf("ERROR: Invalid --choices override: %s", err.Error())
+		}
+	}
+	if options.Providers != nil {
+		if err := catalog.ApplyProviderMix(options.Providers); err != nil {
+			log.Fatalf("ERROR: Invalid --providers %q: %s", options.Providers.String(), err.Error())
+		}
+	}
+	if options.Products != nil {
+		if err := catalog.ApplyProductMix(options.Products); err != nil {
+			log.Fatalf("ERROR: Invalid --products %q: %s", options.Products.String(), err.Error())
+		}
+	}
+	if options.PciFormats != nil {
+		if err := catalog.ApplyPciFormatMix(options.PciFormats); err != nil {
+			log.Fatalf("ERROR: Invalid --pci-formats %q: %s", options.PciFormats.String(), err.Error())
+		}
+	}
+	if catalog.UsesNonDefaultPciFormats() {
+		if missing := catalog.CheckPciDevices(); len(missing) > 0 {
+			log.Fatalf(
+				"ERROR: The PCI device table has no entries for the following catalog devices:\n  %s\n",
+				strings.Join(missing, "\n  "),
+			)
+		}
+	}
 
-func (h *HwInfoStats) Add(profileName string, pInfo *profile.ProfileInfo) {
-	// add an entry for the profile if not seen before
-	if _, exists := h.ProfileStats[profileName]; !exists {
-		h.ProfileStats[profileName] = make(map[string]ProfileInfoStats)
+	// the clients' system information isn't stored in stats only mode
+	var dataStore *clientstore.ClientStore
+	if !options.StatsOnly {
+		log.Printf("Initialising %q as %s datastore\n", options.DataStore, options.Backend)
+		dataStore = clientstore.New(options.DataStore)
+		if err := dataStore.Lock(clientstore.LOCK_EXCLUSIVE, strings.Join(os.Args, " ")); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
 	}
-	if _, exists := h.ProfileStats[profileName][pInfo.Identifier]; !exists {
-		h.ProfileStats[profileName][pInfo.Identifier] = NewProfileKeyStats(pInfo)
+
+	// the manifest, and the existing clients' ids, are only read while
+	// holding the datastore lock, so that concurrent appends can't both
+	// start from the same client id
+	var manifest *clientstore.Manifest
+	if options.Append {
+		// datastores generated by older versions may not have a manifest
+		var err error
+		manifest, err = dataStore.ReadManifest()
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			manifest = nil
+		case err != nil:
+			log.Fatalf("ERROR: %s", err.Error())
+		default:
+			if err = manifest.Validate(); err == nil {
+				err = manifest.CheckBackend(options.Backend)
+			}
+			if err != nil {
+				log.Fatalf("ERROR: Can't append to %q: %s", options.DataStore, err.Error())
+			}
+		}
 	}
 
-	h.ProfileStats[profileName][pInfo.Identifier].Count++
-}
+	// when appending, merge the new clients into the existing stats, read
+	// while holding the datastore lock so that concurrent appends can't
+	// both extend the same stats
+	var hwInfoStats *HwInfoStats
+	if options.Append {
+		var err error
+		hwInfoStats, err = LoadHwInfoStats(options.DataStore)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			log.Printf("No existing client stats found under %q, appending to an empty datastore\n", options.DataStore)
+		case err != nil:
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+	}
 
-func (h *HwInfoStats) Finalize() {
-	h.NumProfileTypes = len(h.ProfileStats)
-	h.NumUniqueProfiles = 0
-	h.ProfileStorageSize = 0
-	h.HwInfoSavings = 0
-	for typeName, typeMap := range h.ProfileStats {
-		h.NumUniqueProfiles += len(typeMap)
-		for pId, pStats := range typeMap {
-			// add the approx size to store the data profile entry itself
-			h.ProfileStorageSize += (8 /* approx size of primary key id field */ +
-				len(typeName) +
-				len(pId) +
-				pStats.Size +
-				18 /* approx size of three timestamp fields, createdAt, updatedAt, lastSeen */)
-
-			// calculate the savings gained by not storing the profile data
-			// in the hwinfo JSON blob.
-			h.HwInfoSavings += (pStats.Count - 1) * pStats.JsonSize
-		}
-	}
-	h.DbNetSavings = h.HwInfoSavings - h.ProfileStorageSize
-}
+	// use the randomly selected generation seed unless one was specified,
+	// or the existing clients' seed when appending, so that the appended
+	// clients match those that a single larger run would have generated
+	switch {
+	case specified["seed"]:
+		client.SetSeed(options.Seed)
+	case hwInfoStats != nil:
+		client.SetSeed(hwInfoStats.Seed)
+	}
+	options.Seed = client.Seed()
+	if hwInfoStats != nil && hwInfoStats.Seed != options.Seed {
+		log.Printf("WARNING: Appending clients using seed %d, differing from the existing clients' seed %d\n", options.Seed, hwInfoStats.Seed)
+	}
 
-func (h *HwInfoStats) Write(dsDir string) (err error) {
-	filePath := filepath.Join(dsDir, "HwInfoStats.json")
+	if dataStore != nil {
+		if err := dataStore.UseBackend(options.Backend); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
 
-	hwisData, err := json.Marshal(h)
-	if err != nil {
-		err = fmt.Errorf(
-			"failed to json.Marshall() HwInfoStats: %w",
-			err,
-		)
-		return
+		// generated clients can be regenerated, so are only synced once
+		// they have all been written, when the datastore is closed
+		dataStore.SetSync(false)
+
+		// appended clients are compressed like the existing clients
+		if manifest != nil && !specified["compress"] {
+			options.Compress = manifest.Compression != ""
+		}
+		dataStore.SetCompression(options.Compress)
+	}
+
+	if options.Append {
+		maxId, found, err := dataStore.MaxFileId(clientstore.SYS_INFO_TYPE)
+		if err != nil {
+			log.Fatalf("ERROR: Failed to determine the highest existing client id: %s", err.Error())
+		}
+
+		nextId := int64(0)
+		if found {
+			nextId = int64(maxId) + 1
+		}
+
+		switch {
+		case !specified["start-id"]:
+			options.StartId = nextId
+		case options.StartId < nextId:
+			log.Fatalf(
+				"ERROR: Start client id %d would overwrite existing clients, which go up to client id %d\n",
+				options.StartId,
+				maxId,
+			)
+		}
+		if options.StartId+options.NumClients >= math.MaxUint32 {
+			log.Fatal(
+				"ERROR: The appended client ids must be less than MaxUint32\n",
+			)
+		}
+		log.Printf("Appending clients to %q starting from client id %d\n", options.DataStore, options.StartId)
 	}
 
-	err = os.WriteFile(filePath, hwisData, 0o644)
-	if err != nil {
-		err = fmt.Errorf(
-			"failed to write HwInfoStats to %q: %w",
-			filePath,
-			err,
+	if options.Project != 0 && options.Project < options.StartId+options.NumClients {
+		log.Fatalf(
+			"ERROR: The number of clients to project to must be at least the %d sampled clients\n",
+			options.StartId+options.NumClients,
+		)
+	}
+	if options.Project >= math.MaxUint32 {
+		log.Fatal(
+			"ERROR: The number of clients to project to must be less than MaxUint32\n",
 		)
-		return
 	}
 
-	return
-}
+	if options.UniqueProfiles < 0 {
+		log.Fatal("ERROR: The number of unique profiles must not be negative\n")
+	}
+	if options.UniqueProfiles > 0 {
+		// use the default probabilities if none were specified
+		if !options.Diversity.Enabled() {
+			options.Diversity = client.DefaultDiversity
+		}
 
-func main() {
-	options = option_defaults
-	flag.StringVar(&options.DataStore, "datastore", option_defaults.DataStore, "Location of `datastore` to store simulated clients")
-	flag.Int64Var(&options.NumClients, "clients", option_defaults.NumClients, "The number of `clients` to simulate")
-	flag.Parse()
+		// size the pool for all of the datastore's clients, matching that of
+		// a single run generating all of them, or for the projected clients
+		// so that the sampled clients are representative of them
+		poolClients := options.StartId + options.NumClients
+		if options.Project > 0 {
+			poolClients = options.Project
+		}
+		var expected int64
+		options.Diversity.VariantPool, expected = catalog.VariantPoolSize(&options.Diversity, options.UniqueProfiles, poolClients)
+		switch {
+		case options.Diversity.VariantPool == 0:
+			log.Printf("WARNING: Target of %d unique profiles is unlikely to be reached, varying all clients independently\n", options.UniqueProfiles)
+		case options.Diversity.VariantPool == 1 && expected > options.UniqueProfiles:
+			log.Printf("WARNING: Target of %d unique profiles is below the achievable floor of about %d, using a single variant per client type and provider\n", options.UniqueProfiles, expected)
+		}
+	}
+	if err := options.Diversity.Validate(); err != nil {
+		log.Fatalf("ERROR: Invalid profile diversity settings: %s", err.Error())
+	}
+	client.SetDiversity(options.Diversity)
+	if options.Diversity.Enabled() {
+		log.Printf("Using profile diversity %+v\n", options.Diversity)
+	}
 
-	if (options.NumClients >= math.MaxUint32) || (options.NumClients < 0) {
-		log.Fatal(
-			"ERROR: The number of clients must be a positive value between 0 and MaxUint32\n",
+	if err := client.SetProfileTypes(strings.Split(options.Profiles, ",")); err != nil {
+		log.Fatalf("ERROR: Invalid --profiles %q: %s", options.Profiles, err.Error())
+	}
+	log.Printf("Generating data profiles %v\n", client.ProfileTypes())
+
+	log.Printf("Using client type mix %v\n", catalog.Mix())
+	log.Printf("Using provider mix %v\n", catalog.ProviderMix())
+	log.Printf("Using product mix %v\n", catalog.ProductMix())
+	log.Printf("Using pci_data format mix %v\n", catalog.PciFormats)
+
+	log.Printf("Simulating %v clients using seed %d\n", options.NumClients, options.Seed)
+
+	if hwInfoStats == nil {
+		hwInfoStats = NewHwInfoStats()
+		hwInfoStats.TypeMix = catalog.Mix()
+		hwInfoStats.ProviderMix = catalog.ProviderMix()
+		hwInfoStats.ProductMix = catalog.ProductMix()
+		hwInfoStats.PciFormatMix = catalog.PciFormats
+	} else {
+		// the existing clients may have been generated using other mixes,
+		// with each run's mixes being recorded in the manifest
+		hwInfoStats.TypeMix = clientstore.CombinedMix(hwInfoStats.TypeMix, catalog.Mix())
+		hwInfoStats.ProviderMix = clientstore.CombinedMix(hwInfoStats.ProviderMix, catalog.ProviderMix())
+		hwInfoStats.ProductMix = clientstore.CombinedMix(hwInfoStats.ProductMix, catalog.ProductMix())
+		hwInfoStats.PciFormatMix = clientstore.CombinedMix(hwInfoStats.PciFormatMix, catalog.PciFormats)
+	}
+	hwInfoStats.Seed = options.Seed
+	hwInfoStats.Diversity = options.Diversity
+	hwInfoStats.UniqueProfilesTarget = options.UniqueProfiles
+	hwInfoStats.ProfileTypes = client.ProfileTypes()
+	hwInfoStats.TopProfiles = options.TopProfiles
+	hwInfoStats.CostModel = costModel
+
+	// clients are generated independently of each other, using their own
+	// random sources, so can be generated in any order
+	wq := workqueue.NewWorkQueue("generate", options.NumJobs)
+	wq.Start()
+	for i := options.StartId; i < options.StartId+options.NumClients; i++ {
+		job := wq.NewJob(i, func() error {
+			return generateClient(i, dataStore, hwInfoStats)
+		})
+		wq.Add(job)
+	}
+	wq.WaitForCompletion()
+
+	if len(wq.Errors) > 0 {
+		log.Printf("ERROR: %v client generation failures occurred:\n", len(wq.Errors))
+		for _, genErr := range wq.Errors {
+			log.Printf("  %s\n", genErr.Error())
+		}
+		log.Fatal("ERROR: failed due to above errors.")
+	}
+
+	if dataStore != nil {
+		logical, stored := dataStore.WriteSizes()
+		hwInfoStats.AddStoredSize(logical, stored)
+		log.Printf(
+			"Client files total %d bytes, stored as %d bytes, %.1f%% of their logical size\n",
+			logical,
+			stored,
+			100*float64(stored)/float64(max(logical, 1)),
 		)
 	}
 
-	log.Printf("Initialising %q as datastore\n", options.DataStore)
-	dataStore := clientstore.New(options.DataStore)
+	hwInfoStats.Finalize()
 
-	log.Printf("Simulating %v clients\n", options.NumClients)
+	// any projection from previously appended clients is superseded
+	hwInfoStats.Projection = nil
+	if options.Project > 0 {
+		hwInfoStats.Projection = NewProjection(hwInfoStats, options.Project)
+		logProjection(hwInfoStats.Projection)
+	}
 
-	hwInfoStats := NewHwInfoStats()
-	for i := int64(0); i < options.NumClients; i++ {
-		c := client.NewClient(client.ClientId(i))
-		sysInfo := c.SystemInfo()
+	if options.StatsOnly {
+		if err := hwInfoStats.WriteFile(options.StatsFile); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
 
-		fileId := clientstore.FileId(i)
-		fileType := clientstore.SYS_INFO_TYPE
-		err := dataStore.WriteFile(fileId, fileType, []byte(sysInfo), 0o644)
-		if err != nil {
+		log.Printf(
+			"Generated stats for %d clients in %q",
+			options.NumClients,
+			options.StatsFile,
+		)
+	} else {
+		if err := hwInfoStats.Write(options.DataStore); err != nil {
 			log.Fatalf(
-				"Failed to write client %v to %q: %s",
-				i,
-				fileId.Path(fileType),
-				err.Error(),
+				"Failed to record client hardware info stats for %d generated clients under %q",
+				options.NumClients,
+				options.DataStore,
 			)
 		}
 
-		hwInfoStats.Add(client.MOD_DATA_PROFILE, c.ModData)
-		hwInfoStats.Add(client.PCI_DATA_PROFILE, c.PciData)
-	}
+		if err := writeManifest(dataStore, manifest, hwInfoStats); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
 
-	hwInfoStats.Finalize()
-	if err := hwInfoStats.Write(options.DataStore); err != nil {
-		log.Fatalf(
-			"Failed to record client hardware info stats for %d generated clients under %q",
+		if err := dataStore.Close(); err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+
+		log.Printf(
+			"Generated hardware info for %d clients under %q, which now holds %d clients",
 			options.NumClients,
 			options.DataStore,
+			hwInfoStats.NumClients,
 		)
 	}
 
+	clientStatOpts := workqueue.SummaryOpts{
+		workqueue.OPT_NAME:        "Client generate",
+		workqueue.OPT_RATE:        true,
+		workqueue.OPT_MIN_MAX:     true,
+		workqueue.OPT_EXTRA_STATS: true,
+	}
+
+	parallelStatOpts := workqueue.SummaryOpts{
+		workqueue.OPT_NAME:        "Parallel Job",
+		workqueue.OPT_MIN_MAX:     true,
+		workqueue.OPT_EXTRA_STATS: true,
+	}
+
+	fmt.Println(wq.Stats.JobStats().Summary(clientStatOpts))
+	fmt.Println(wq.Stats.PoolStats().Summary(parallelStatOpts))
+}
+
+func logProjection(p *Projection) {
 	log.Printf(
-		"Generated hardware info for %d clients under %q",
-		options.NumClients,
-		options.DataStore,
+		"Projected stats from %d to %d clients, with %.0f%% confidence intervals:\n",
+		p.SampleClients,
+		p.NumClients,
+		p.Confidence*100,
 	)
+	log.Printf("  System information size: %s\n", p.SysInfoSize)
+	log.Printf("  Unique profiles:         %s\n", p.UniqueProfiles)
+	log.Printf("  Profile storage size:    %s\n", p.ProfileStorageSize)
+	log.Printf("  HwInfo savings:          %s\n", p.HwInfoSavings)
+	log.Printf("  DB net savings:          %s\n", p.DbNetSavings)
+}
+
+// writeManifest records how the datastore's clients were generated, updating
+// the existing manifest, if any, when appending clients.
+func writeManifest(dataStore *clientstore.ClientStore, manifest *clientstore.Manifest, hwInfoStats *HwInfoStats) (err error) {
+	now := time.Now().UTC()
+	if manifest == nil {
+		manifest = &clientstore.Manifest{
+			CreatedAt: now,
+		}
+	}
+
+	manifest.SchemaVersion = clientstore.MANIFEST_SCHEMA_VERSION
+	manifest.Generator = AppName
+	manifest.GeneratorVersion = AppVersion
+
+	// record the run, combining its mixes with those of existing clients
+	catalog := client.ActiveCatalog()
+	manifest.AddRun(clientstore.GeneratorRun{
+		Time:         now,
+		Seed:         options.Seed,
+		StartId:      options.StartId,
+		NumClients:   options.NumClients,
+		TypeMix:      catalog.Mix(),
+		ProviderMix:  catalog.ProviderMix(),
+		ProductMix:   catalog.ProductMix(),
+		PciFormatMix: catalog.PciFormats,
+	})
+	manifest.UpdatedAt = now
+	manifest.NumClients = hwInfoStats.NumClients
+	manifest.NextId = max(manifest.NextId, options.StartId+options.NumClients)
+
+	// determine the existing clients when appending to datastores whose
+	// manifest doesn't record the ranges of generated client ids
+	if options.Append && len(manifest.ClientRanges) == 0 {
+		var existing []clientstore.ClientRange
+		err = dataStore.WalkFileIds(clientstore.SYS_INFO_TYPE, func(id clientstore.FileId) error {
+			if n := len(existing); n > 0 && existing[n-1].Last+1 == id {
+				existing[n-1].Last = id
+			} else {
+				existing = append(existing, clientstore.ClientRange{First: id, Last: id})
+			}
+			return nil
+		})
+		if err != nil {
+			err = fmt.Errorf(
+				"failed to determine the existing clients: %w",
+				err,
+			)
+			return
+		}
+		manifest.AddClients(existing...)
+	}
+	if options.NumClients > 0 {
+		manifest.AddClients(clientstore.ClientRange{
+			First: clientstore.FileId(options.StartId),
+			Last:  clientstore.FileId(options.StartId + options.NumClients - 1),
+		})
+	}
+
+	manifest.Backend = dataStore.Backend()
+	manifest.Compression = dataStore.Compression()
+
+	// appended clients may have been generated with other profile types
+	for _, profileType := range hwInfoStats.ProfileTypes {
+		if !slices.Contains(manifest.ProfileTypes, profileType) {
+			manifest.ProfileTypes = append(manifest.ProfileTypes, profileType)
+		}
+	}
+
+	return dataStore.WriteManifest(manifest)
+}
+
+func generateClient(id int64, dataStore *clientstore.ClientStore, hwInfoStats *HwInfoStats) (err error) {
+	c := client.NewClient(client.ClientId(id))
+	sysInfo := c.SystemInfo()
+
+	// no datastore is used in stats only mode
+	if dataStore != nil {
+		fileId := clientstore.FileId(id)
+		fileType := clientstore.SYS_INFO_TYPE
+		err = dataStore.WriteFile(fileId, fileType, []byte(sysInfo), 0o644)
+		if err != nil {
+			err = fmt.Errorf(
+				"failed to write client %v to %q: %w",
+				id,
+				fileId.Path(fileType),
+				err,
+			)
+			return
+		}
+
+		clientInfo := &clientstore.ClientInfo{
+			Type:         c.Type.Name,
+			Provider:     c.Provider.String(),
+			Product:      productInfo(c.Product),
+			ExtensionSet: c.ExtensionSet,
+			Extensions:   c.Extensions,
+		}
+		err = dataStore.WriteClientInfo(fileId, clientInfo)
+		if err != nil {
+			err = fmt.Errorf(
+				"failed to write client %v info to %q: %w",
+				id,
+				fileId.Path(clientstore.CLIENT_INFO_TYPE),
+				err,
+			)
+			return
+		}
+
+		// only cloud instances have instance data
+		if c.InstanceData != "" {
+			fileType = clientstore.INST_DATA_TYPE
+			err = dataStore.WriteFile(fileId, fileType, []byte(c.InstanceData), 0o644)
+			if err != nil {
+				err = fmt.Errorf(
+					"failed to write client %v instance data to %q: %w",
+					id,
+					fileId.Path(fileType),
+					err,
+				)
+				return
+			}
+		}
+	}
+
+	hwInfoStats.AddClient(c, sysInfo)
+
+	return
+}
+
+// productInfo returns the details of the client's base product recorded in
+// the datastore, or nil if the catalog doesn't define any products.
+func productInfo(p *client.Product) *clientstore.ProductInfo {
+	if p == nil {
+		return nil
+	}
+	return &clientstore.ProductInfo{
+		Name:       p.Name,
+		Identifier: p.Identifier,
+		Version:    p.Version,
+	}
 }
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+)
+
+// MixSpec is a flag.Value holding a weighted mix of names, specified as
+// a comma separated list of NAME=WEIGHT entries.
+type MixSpec map[string]int
+
+func (m *MixSpec) String() string {
+	if m == nil || *m == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(*m))
+	for name := range *m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fmt.Sprintf("%s=%d", name, (*m)[name]))
+	}
+
+	return strings.Join(entries, ",")
+}
+
+func (m *MixSpec) Set(value string) (err error) {
+	mix := make(MixSpec)
+	for _, entry := range strings.Split(value, ",") {
+		name, weightStr, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || name == "" {
+			err = fmt.Errorf(
+				"invalid mix entry %q, must be NAME=WEIGHT",
+				entry,
+			)
+			return
+		}
+
+		weight, convErr := strconv.Atoi(weightStr)
+		if convErr != nil || weight < 0 {
+			err = fmt.Errorf(
+				"invalid weight %q for %q, must be a non-negative integer",
+				weightStr,
+				name,
+			)
+			return
+		}
+
+		if _, dup := mix[name]; dup {
+			err = fmt.Errorf(
+				"duplicate mix entry %q, each name must only be specified once",
+				name,
+			)
+			return
+		}
+
+		mix[name] = weight
+	}
+
+	*m = mix
+	return
+}
+
+type ChoiceOverride struct {
+	TypeName  string
+	TableName string
+	Choices   []choice.Choice
+}
+
+// ChoiceOverrides is a repeatable flag.Value holding overrides of per
+// client type choice tables, specified as TYPE.TABLE=VALUE:WEIGHT,...
+type ChoiceOverrides []ChoiceOverride
+
+func (o *ChoiceOverrides) String() string {
+	if o == nil {
+		return ""
+	}
+
+	specs := make([]string, 0, len(*o))
+	for _, override := range *o {
+		entries := make([]string, 0, len(override.Choices))
+		for _, c := range override.Choices {
+			entries = append(entries, fmt.Sprintf("%v:%d", c.Value, c.Weight))
+		}
+		specs = append(specs, fmt.Sprintf(
+			"%s.%s=%s",
+			override.TypeName,
+			override.TableName,
+			strings.Join(entries, ","),
+		))
+	}
+
+	return strings.Join(specs, " ")
+}
+
+func (o *ChoiceOverrides) Set(value string) (err error) {
+	target, tableSpec, found := strings.Cut(value, "=")
+	if !found {
+		err = fmt.Errorf(
+			"invalid choice override %q, must be TYPE.TABLE=VALUE:WEIGHT,...",
+			value,
+		)
+		return
+	}
+
+	typeName, tableName, found := strings.Cut(target, ".")
+	if !found || typeName == "" || tableName == "" {
+		err = fmt.Errorf(
+			"invalid choice override target %q, must be TYPE.TABLE",
+			target,
+		)
+		return
+	}
+
+	override := ChoiceOverride{
+		TypeName:  typeName,
+		TableName: tableName,
+	}
+	for _, entry := range strings.Split(tableSpec, ",") {
+		valueStr, weightStr, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			err = fmt.Errorf(
+				"invalid choice entry %q, must be VALUE:WEIGHT",
+				entry,
+			)
+			return
+		}
+
+		value, convErr := strconv.Atoi(valueStr)
+		if convErr != nil {
+			err = fmt.Errorf(
+				"invalid choice value %q: %w",
+				valueStr,
+				convErr,
+			)
+			return
+		}
+
+		weight, convErr := strconv.Atoi(weightStr)
+		if convErr != nil {
+			err = fmt.Errorf(
+				"invalid choice weight %q: %w",
+				weightStr,
+				convErr,
+			)
+			return
+		}
+
+		override.Choices = append(override.Choices, choice.Choice{
+			Weight: weight,
+			Value:  value,
+		})
+	}
+
+	*o = append(*o, override)
+	return
+}
+
+// PathList is a repeatable flag.Value holding a list of file paths.
+type PathList []string
+
+func (p *PathList) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(*p, ",")
+}
+
+func (p *PathList) Set(value string) (err error) {
+	if value == "" {
+		err = fmt.Errorf("invalid empty path")
+		return
+	}
+
+	*p = append(*p, value)
+	return
+}
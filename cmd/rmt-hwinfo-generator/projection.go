@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// confidence level, and associated z score, of the projected estimates
+const (
+	PROJECTION_CONFIDENCE = 0.95
+	PROJECTION_Z          = 1.96
+)
+
+// Estimate is a projected value along with its confidence interval.
+type Estimate struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+func (e Estimate) String() string {
+	return fmt.Sprintf("%.0f [%.0f, %.0f]", e.Value, e.Lower, e.Upper)
+}
+
+func (e Estimate) Add(other Estimate) Estimate {
+	return Estimate{
+		Value: e.Value + other.Value,
+		Lower: e.Lower + other.Lower,
+		Upper: e.Upper + other.Upper,
+	}
+}
+
+// ProfileProjection holds the projected unique profiles of a profile type,
+// and the associated storage size and savings, along with the frequency
+// counts of the sampled profiles that they are derived from.
+type ProfileProjection struct {
+	Observed       int      `json:"observed"`
+	Singletons     int      `json:"singletons"`
+	Doubletons     int      `json:"doubletons"`
+	Unseen         Estimate `json:"unseen"`
+	UniqueProfiles Estimate `json:"uniqueProfiles"`
+	StorageSize    Estimate `json:"storageSize"`
+	HwInfoSavings  Estimate `json:"hwInfoSavings"`
+}
+
+// Projection extrapolates the stats of a sample of clients to a larger
+// number of clients generated using the same settings.
+type Projection struct {
+	SampleClients      int64                         `json:"sampleClients"`
+	NumClients         int64                         `json:"numClients"`
+	Confidence         float64                       `json:"confidence"`
+	SysInfoSize        Estimate                      `json:"sysInfoSize"`
+	BaseSysInfoSize    Estimate                      `json:"baseSysInfoSize"`
+	Profiles           map[string]*ProfileProjection `json:"profiles"`
+	UniqueProfiles     Estimate                      `json:"uniqueProfiles"`
+	ProfileStorageSize Estimate                      `json:"profileStorageSize"`
+	HwInfoSavings      Estimate                      `json:"hwInfoSavings"`
+	DbNetSavings       Estimate                      `json:"dbNetSavings"`
+}
+
+// projectTotal estimates the total of a per client value for numClients,
+// from the mean of the sampled values and its standard error.
+func projectTotal(d *Distribution, numClients int64) (e Estimate) {
+	if d.Count == 0 {
+		return
+	}
+
+	margin := PROJECTION_Z * d.StdDev / math.Sqrt(float64(d.Count))
+	e.Value = d.Mean * float64(numClients)
+	e.Lower = max(d.Mean-margin, 0) * float64(numClients)
+	e.Upper = (d.Mean + margin) * float64(numClients)
+
+	return
+}
+
+// chao1Unseen estimates the number of unique profiles not seen in a sample
+// of n clients from the number of profiles seen once (f1) and twice (f2),
+// using the Chao1 estimator, along with its log-normal confidence interval.
+func chao1Unseen(n int64, observed, f1, f2 int) (e Estimate) {
+	k := float64(n-1) / float64(n)
+	F1, F2 := float64(f1), float64(f2)
+
+	var variance float64
+	if f2 > 0 {
+		e.Value = k * F1 * F1 / (2 * F2)
+		r := F1 / F2
+		variance = F2 * (k*r*r/2 + k*k*r*r*r + k*k*r*r*r*r/4)
+	} else {
+		// bias corrected form, for samples without doubletons
+		e.Value = k * F1 * (F1 - 1) / 2
+		variance = k*F1*(F1-1)/2 +
+			k*k*F1*(2*F1-1)*(2*F1-1)/4 -
+			k*k*F1*F1*F1*F1/(4*(float64(observed)+e.Value))
+	}
+
+	if e.Value <= 0 {
+		e = Estimate{}
+		return
+	}
+
+	c := math.Exp(PROJECTION_Z * math.Sqrt(math.Log(1+max(variance, 0)/(e.Value*e.Value))))
+	e.Lower = e.Value / c
+	e.Upper = e.Value * c
+
+	return
+}
+
+// extrapolateUnique estimates the number of unique profiles that would be
+// seen in numClients clients, given the number observed in a sample of n
+// clients, the number of singletons and the estimated number unseen.
+func extrapolateUnique(n, numClients int64, observed, f1 int, unseen float64) float64 {
+	m := numClients - n
+	if unseen <= 0 || m <= 0 {
+		return float64(observed)
+	}
+
+	discovered := 1 - math.Pow(1-float64(f1)/(float64(n)*unseen+float64(f1)), float64(m))
+
+	return float64(observed) + unseen*discovered
+}
+
+// NewProjection extrapolates the finalized stats to numClients clients.
+func NewProjection(h *HwInfoStats, numClients int64) *Projection {
+	n := h.NumClients
+	p := &Projection{
+		SampleClients:   n,
+		NumClients:      numClients,
+		Confidence:      PROJECTION_CONFIDENCE,
+		SysInfoSize:     projectTotal(&h.Distributions.SysInfoSize, numClients),
+		BaseSysInfoSize: projectTotal(&h.Distributions.BaseSysInfoSize, numClients),
+		Profiles:        make(map[string]*ProfileProjection, len(h.ProfileStats)),
+	}
+	if n == 0 {
+		return p
+	}
+	scale := float64(numClients) / float64(n)
+
+	for typeName, typeMap := range h.ProfileStats {
+		pp := &ProfileProjection{
+			Observed: len(typeMap),
+		}
+
+		var rowSize, jsonSize, clientJsonSize float64
+		for pId, pStats := range typeMap {
+			switch pStats.Count {
+			case 1:
+				pp.Singletons++
+			case 2:
+				pp.Doubletons++
+			}
+			rowSize += h.CostModel.ProfileRowSize(typeName, pId, pStats)
+			jsonSize += float64(pStats.JsonSize)
+			clientJsonSize += float64(pStats.Count * pStats.JsonSize)
+		}
+
+		pp.Unseen = chao1Unseen(n, pp.Observed, pp.Singletons, pp.Doubletons)
+		pp.UniqueProfiles = Estimate{
+			Value: extrapolateUnique(n, numClients, pp.Observed, pp.Singletons, pp.Unseen.Value),
+			Lower: extrapolateUnique(n, numClients, pp.Observed, pp.Singletons, pp.Unseen.Lower),
+			Upper: extrapolateUnique(n, numClients, pp.Observed, pp.Singletons, pp.Unseen.Upper),
+		}
+
+		// the projected unique profiles have the same mean sizes as the
+		// sampled ones, with more unique profiles costing more storage
+		// while saving less system information storage
+		meanRowSize := rowSize / float64(pp.Observed)
+		meanJsonSize := jsonSize / float64(pp.Observed)
+		savings := func(unique float64) float64 {
+			return (clientJsonSize*scale - unique*meanJsonSize) * h.CostModel.CompressionFactor
+		}
+		pp.StorageSize = Estimate{
+			Value: pp.UniqueProfiles.Value * meanRowSize,
+			Lower: pp.UniqueProfiles.Lower * meanRowSize,
+			Upper: pp.UniqueProfiles.Upper * meanRowSize,
+		}
+		pp.HwInfoSavings = Estimate{
+			Value: savings(pp.UniqueProfiles.Value),
+			Lower: savings(pp.UniqueProfiles.Upper),
+			Upper: savings(pp.UniqueProfiles.Lower),
+		}
+
+		p.Profiles[typeName] = pp
+		p.UniqueProfiles = p.UniqueProfiles.Add(pp.UniqueProfiles)
+		p.ProfileStorageSize = p.ProfileStorageSize.Add(pp.StorageSize)
+		p.HwInfoSavings = p.HwInfoSavings.Add(pp.HwInfoSavings)
+	}
+
+	// the lowest savings coincide with the highest storage size
+	p.DbNetSavings = Estimate{
+		Value: p.HwInfoSavings.Value - p.ProfileStorageSize.Value,
+		Lower: p.HwInfoSavings.Lower - p.ProfileStorageSize.Upper,
+		Upper: p.HwInfoSavings.Upper - p.ProfileStorageSize.Lower,
+	}
+
+	return p
+}
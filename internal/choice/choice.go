@@ -2,23 +2,29 @@ package choice
 
 import (
 	"math/rand"
-	"time"
 )
 
 type Choice struct {
-	Weight int
-	Value  any
+	Weight int `json:"weight"`
+	Value  any `json:"value"`
 }
 
-func randomValue(numValues int) int {
-	rs := rand.NewSource(time.Now().UnixNano())
-
-	r := rand.New(rs)
+func randomValue(r *rand.Rand, numValues int) int {
+	// fall back to the shared, randomly seeded, source if none provided
+	if r == nil {
+		return rand.Intn(numValues)
+	}
 
 	return r.Intn(numValues)
 }
 
 func Choose(choices []Choice) any {
+	return ChooseWith(nil, choices)
+}
+
+// ChooseWith makes a weighted choice using the provided random source so
+// that the sequence of choices made is reproducible.
+func ChooseWith(r *rand.Rand, choices []Choice) any {
 	var totWeight int
 	var weights []int
 
@@ -28,7 +34,7 @@ func Choose(choices []Choice) any {
 		weights = append(weights, totWeight)
 	}
 
-	randChoice := randomValue(totWeight)
+	randChoice := randomValue(r, totWeight)
 
 	var chosen int
 	for i, weight := range weights {
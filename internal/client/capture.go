@@ -0,0 +1,247 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+)
+
+// CaptureOpts specifies where to capture a machine's hardware from.
+type CaptureOpts struct {
+	Name   string // client type name
+	Weight int    // client type weight
+	Arch   string // client type arch
+	Root   string // root directory containing the proc files
+	Lspci  []byte // output of `lspci -vmm -nn`, or `lspci -vmm`
+}
+
+// Capture generates a catalog holding a client type template matching
+// the captured machine's hardware, along with PCI device table entries
+// for its devices, if the lspci output includes numeric ids.
+func Capture(opts *CaptureOpts) (cat *Catalog, err error) {
+	ct := &ClientType{
+		Name:   opts.Name,
+		Weight: opts.Weight,
+		HwInfo: ClientHwInfo{
+			Arch: opts.Arch,
+		},
+		// the captured machine's devices are all included in the header
+		DiskChoices: []choice.Choice{{Weight: 100, Value: 0}},
+		GPUChoices:  []choice.Choice{{Weight: 100, Value: 0}},
+		NetChoices:  []choice.Choice{{Weight: 100, Value: 0}},
+	}
+
+	if ct.HwInfo.Cpus, ct.HwInfo.Sockets, err = captureCpuInfo(opts.Root); err != nil {
+		return
+	}
+	if ct.HwInfo.Memory, err = captureMemInfo(opts.Root); err != nil {
+		return
+	}
+	if ct.ModList, err = captureModules(opts.Root); err != nil {
+		return
+	}
+
+	cat = &Catalog{
+		ClientTypes: []*ClientType{ct},
+	}
+	if ct.PciData, cat.PciDevices, err = capturePciData(opts.Lspci); err != nil {
+		cat = nil
+		return
+	}
+
+	// sanity check the template
+	if err = ct.validate(); err != nil {
+		cat = nil
+		return
+	}
+
+	return
+}
+
+func readProcFile(root, name string) (data []byte, err error) {
+	procPath := filepath.Join(root, "proc", name)
+	if data, err = os.ReadFile(procPath); err != nil {
+		err = fmt.Errorf(
+			"failed to read %q: %w",
+			procPath,
+			err,
+		)
+	}
+	return
+}
+
+// number of processors and distinct physical packages in /proc/cpuinfo
+func captureCpuInfo(root string) (cpus, sockets int, err error) {
+	data, err := readProcFile(root, "cpuinfo")
+	if err != nil {
+		return
+	}
+
+	packages := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "processor":
+			cpus++
+		case "physical id":
+			packages[strings.TrimSpace(value)] = true
+		}
+	}
+
+	if cpus == 0 {
+		err = fmt.Errorf("no processors found in cpuinfo")
+		return
+	}
+
+	// not all arches report physical ids
+	sockets = max(len(packages), 1)
+
+	return
+}
+
+// MemTotal from /proc/meminfo, in MiB
+func captureMemInfo(root string) (memory int, err error) {
+	data, err := readProcFile(root, "meminfo")
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+
+		var kb int
+		if kb, err = strconv.Atoi(fields[1]); err != nil {
+			err = fmt.Errorf("invalid MemTotal %q in meminfo: %w", fields[1], err)
+			return
+		}
+		memory = kb / 1024
+		return
+	}
+
+	err = fmt.Errorf("no MemTotal found in meminfo")
+
+	return
+}
+
+// sorted module names from /proc/modules, matching the lsmod based mod_list
+func captureModules(root string) (modList []string, err error) {
+	data, err := readProcFile(root, "modules")
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			modList = append(modList, fields[0])
+		}
+	}
+	sort.Strings(modList)
+
+	return
+}
+
+// split a `lspci -nn` name into the name and its trailing [id]
+var pciNameIdRe = regexp.MustCompile(`^(.*) \[([0-9a-f]{4})\]$`)
+
+func splitPciNameId(value string) (name, id string) {
+	if match := pciNameIdRe.FindStringSubmatch(value); match != nil {
+		return match[1], match[2]
+	}
+	return value, ""
+}
+
+// capturePciData converts `lspci -vmm [-nn]` records into a PCI data spec
+// whose header holds all of the devices in the standard lspci format,
+// along with the PCI device table entries for those devices if the
+// numeric ids are available. Devices for any added disks, GPUs or NICs
+// use the first such captured device, in the slots following the last
+// device on the first bus.
+func capturePciData(lspci []byte) (spec PciDataSpec, devices []*PciDevice, err error) {
+	seen := make(map[string]bool)
+	lastBus, lastSlot := -1, -1
+	for _, block := range strings.Split(strings.TrimSpace(string(lspci)), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+
+		fields := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			key, value, found := strings.Cut(line, ":\t")
+			if found {
+				fields[key] = value
+			}
+		}
+
+		slot := fields["Slot"]
+		if slot == "" {
+			err = fmt.Errorf("lspci record has no Slot:\n%s", block)
+			return
+		}
+
+		d := new(PciDevice)
+		d.Class, d.ClassId = splitPciNameId(fields["Class"])
+		d.Vendor, d.VendorId = splitPciNameId(fields["Vendor"])
+		d.Device, d.DeviceId = splitPciNameId(fields["Device"])
+
+		// unassigned classes include the class id in the lspci name
+		if strings.HasPrefix(d.Class, "Unassigned class") || strings.HasPrefix(d.Class, "Class ") {
+			d.Class += " [" + d.ClassId + "]"
+		}
+
+		device := d.Description()
+		if rev := fields["Rev"]; rev != "" {
+			device += " (rev " + rev + ")"
+		}
+		spec.Header = append(spec.Header, slot+" "+device)
+
+		switch {
+		case spec.DiskDevice == "" && (d.ClassId == "0108" || d.ClassId == "0100" || d.ClassId == "0106" ||
+			strings.HasPrefix(d.Class, "Non-Volatile memory controller") || strings.HasPrefix(d.Class, "SCSI storage controller")):
+			spec.DiskDevice = device
+		case spec.GPUDevice == "" && (d.ClassId == "0302" || strings.HasPrefix(d.Class, "3D controller")):
+			spec.GPUDevice = device
+		case spec.NetDevice == "" && (d.ClassId == "0200" || strings.HasPrefix(d.Class, "Ethernet controller")):
+			spec.NetDevice = device
+		}
+
+		if d.ClassId != "" && d.VendorId != "" && d.DeviceId != "" && !seen[d.Description()] {
+			seen[d.Description()] = true
+			devices = append(devices, d)
+		}
+
+		// track the last slot on the first bus
+		var bus, dev int
+		if _, scanErr := fmt.Sscanf(slot[max(len(slot)-7, 0):], "%02x:%02x", &bus, &dev); scanErr == nil {
+			if lastBus < 0 || bus < lastBus || (bus == lastBus && dev > lastSlot) {
+				lastBus, lastSlot = bus, dev
+			}
+		}
+	}
+
+	if len(spec.Header) == 0 {
+		err = fmt.Errorf("no PCI devices found in lspci output")
+		return
+	}
+
+	spec.Bus = max(lastBus, 0)
+	spec.Slot = lastSlot + 1
+
+	return
+}
@@ -0,0 +1,690 @@
+package client
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+)
+
+// default catalog of client types shipped with the generator
+//
+//go:embed catalog/default.json
+var defaultCatalogData []byte
+
+type ClientHwInfo struct {
+	Arch    string `json:"arch"`
+	Cpus    int    `json:"cpus"`
+	Memory  int    `json:"memory"`
+	Sockets int    `json:"sockets"`
+}
+
+type PciDataSpec struct {
+	Bus        int      `json:"bus"`        // PCI Bus to add new entries to
+	Slot       int      `json:"slot"`       // Starting PCI Slot for new entries
+	DiskDevice string   `json:"diskDevice"` // lspci device string for added disks
+	GPUDevice  string   `json:"gpuDevice"`  // lspci device string for added GPUs
+	NetDevice  string   `json:"netDevice"`  // lspci device string for added NICs
+	Header     []string `json:"header"`
+}
+
+type ClientType struct {
+	Name        string          `json:"name"`
+	Weight      int             `json:"weight"`
+	HwInfo      ClientHwInfo    `json:"hwInfo"`
+	PciData     PciDataSpec     `json:"pciData"`
+	ModList     []string        `json:"modList"`
+	DiskChoices []choice.Choice `json:"diskChoices"`
+	GPUChoices  []choice.Choice `json:"gpuChoices"`
+	NetChoices  []choice.Choice `json:"netChoices"`
+
+	// disk sizes in GiB, used by the blk_data profile
+	DiskSizeChoices []choice.Choice `json:"diskSizeChoices,omitempty"`
+
+	// CPUs, memory in MiB, and sockets, defaulting to the hwInfo values
+	CpuChoices    []choice.Choice `json:"cpuChoices,omitempty"`
+	MemoryChoices []choice.Choice `json:"memoryChoices,omitempty"`
+	SocketChoices []choice.Choice `json:"socketChoices,omitempty"`
+
+	// if specified, overrides the catalog's extension sets
+	ExtensionSets []*ExtensionSet `json:"extensionSets,omitempty"`
+}
+
+func (ct *ClientType) String() string {
+	if ct == nil {
+		return "UNKNOWN"
+	}
+	return ct.Name
+}
+
+func (ct *ClientType) NewClient(id ClientId, provider *Provider, r *rand.Rand) *Client {
+	c := new(Client)
+
+	numDisk := choice.ChooseWith(r, ct.DiskChoices).(int)
+	numGPU := choice.ChooseWith(r, ct.GPUChoices).(int)
+	numNet := choice.ChooseWith(r, ct.NetChoices).(int)
+
+	c.Init(ct, id, numDisk, numGPU, numNet, r)
+	c.Provider = provider
+
+	c.setupPciData(ct.pciDataSpec(provider))
+	c.setupModData(ct.modList(provider))
+
+	return c
+}
+
+// setupSizing chooses the client's CPUs, memory and sockets.
+func (ct *ClientType) setupSizing(c *Client, r *rand.Rand) {
+	c.Cpus = choice.ChooseWith(r, ct.CpuChoices).(int)
+	c.Memory = choice.ChooseWith(r, ct.MemoryChoices).(int)
+	c.Sockets = choice.ChooseWith(r, ct.SocketChoices).(int)
+}
+
+// convert the JSON decoded float64 values of a count choice table to ints,
+// checking that they are at least minValue, and that the table can be
+// chosen from
+func (ct *ClientType) normaliseCountChoices(tableName string, choices []choice.Choice, minValue int) (err error) {
+	if len(choices) == 0 {
+		err = fmt.Errorf(
+			"client type %q has no %s entries",
+			ct.Name,
+			tableName,
+		)
+		return
+	}
+
+	totWeight := 0
+	for i := range choices {
+		switch v := choices[i].Value.(type) {
+		case int:
+			if v < minValue {
+				err = fmt.Errorf(
+					"client type %q %s entry %d value %d is not an integer of at least %d",
+					ct.Name,
+					tableName,
+					i,
+					v,
+					minValue,
+				)
+				return
+			}
+		case float64:
+			if v != math.Trunc(v) || v < float64(minValue) {
+				err = fmt.Errorf(
+					"client type %q %s entry %d value %v is not an integer of at least %d",
+					ct.Name,
+					tableName,
+					i,
+					v,
+					minValue,
+				)
+				return
+			}
+			choices[i].Value = int(v)
+		default:
+			err = fmt.Errorf(
+				"client type %q %s entry %d has unsupported value type %T",
+				ct.Name,
+				tableName,
+				i,
+				v,
+			)
+			return
+		}
+
+		if choices[i].Weight < 0 {
+			err = fmt.Errorf(
+				"client type %q %s entry %d has negative weight %d",
+				ct.Name,
+				tableName,
+				i,
+				choices[i].Weight,
+			)
+			return
+		}
+		totWeight += choices[i].Weight
+	}
+
+	// a weighted choice can't be made if all the weights are zero
+	if totWeight <= 0 {
+		err = fmt.Errorf(
+			"client type %q %s weights must sum to a positive value",
+			ct.Name,
+			tableName,
+		)
+		return
+	}
+
+	return
+}
+
+func (ct *ClientType) validate() (err error) {
+	if ct.Name == "" {
+		err = fmt.Errorf("client type has no name")
+		return
+	}
+
+	if ct.Weight < 0 {
+		err = fmt.Errorf(
+			"client type %q has negative weight %d",
+			ct.Name,
+			ct.Weight,
+		)
+		return
+	}
+
+	// default to a single disk size for catalogs that don't specify any
+	if len(ct.DiskSizeChoices) == 0 {
+		ct.DiskSizeChoices = []choice.Choice{{Weight: 100, Value: 100}}
+	}
+
+	// default to the hwInfo sizing for client types that don't vary it
+	if len(ct.CpuChoices) == 0 {
+		ct.CpuChoices = []choice.Choice{{Weight: 100, Value: ct.HwInfo.Cpus}}
+	}
+	if len(ct.MemoryChoices) == 0 {
+		ct.MemoryChoices = []choice.Choice{{Weight: 100, Value: ct.HwInfo.Memory}}
+	}
+	if len(ct.SocketChoices) == 0 {
+		ct.SocketChoices = []choice.Choice{{Weight: 100, Value: ct.HwInfo.Sockets}}
+	}
+
+	// clients can lack disks, GPUs or NICs, but not CPUs, memory or
+	// sockets, and disks must be at least 1 GiB
+	countTables := []struct {
+		name     string
+		choices  []choice.Choice
+		minValue int
+	}{
+		{"diskChoices", ct.DiskChoices, 0},
+		{"gpuChoices", ct.GPUChoices, 0},
+		{"netChoices", ct.NetChoices, 0},
+		{"diskSizeChoices", ct.DiskSizeChoices, 1},
+		{"cpuChoices", ct.CpuChoices, 1},
+		{"memoryChoices", ct.MemoryChoices, 1},
+		{"socketChoices", ct.SocketChoices, 1},
+	}
+	for _, t := range countTables {
+		if err = ct.normaliseCountChoices(t.name, t.choices, t.minValue); err != nil {
+			return
+		}
+	}
+
+	if err = validateExtensionSets(ct.ExtensionSets); err != nil {
+		err = fmt.Errorf(
+			"client type %q: %w",
+			ct.Name,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+type Catalog struct {
+	ClientTypes []*ClientType  `json:"clientTypes"`
+	Providers   []*Provider    `json:"providers,omitempty"`
+	Products    []*Product     `json:"products,omitempty"`
+	PciFormats  map[string]int `json:"pciFormats,omitempty"`
+	PciDevices  []*PciDevice   `json:"pciDevices,omitempty"`
+
+	// optional modules and devices that may be added to clients when
+	// generating diverse profiles
+	OptionalModules []string `json:"optionalModules,omitempty"`
+	OptionalDevices []string `json:"optionalDevices,omitempty"`
+
+	// weighted sets of extensions activated by the clients
+	ExtensionSets []*ExtensionSet `json:"extensionSets,omitempty"`
+
+	// default PCI device table extended with the catalog's PciDevices
+	pciDevices PciDeviceTable
+}
+
+func NewCatalog(data []byte) (cat *Catalog, err error) {
+	cat = new(Catalog)
+	if err = cat.Init(data); err != nil {
+		cat = nil
+	}
+	return
+}
+
+func (cat *Catalog) Init(data []byte) (err error) {
+	if err = json.Unmarshal(data, cat); err != nil {
+		err = fmt.Errorf(
+			"failed to unmarshal client type catalog JSON: %w",
+			err,
+		)
+		return
+	}
+
+	return cat.validate()
+}
+
+func (cat *Catalog) validate() (err error) {
+	if len(cat.ClientTypes) == 0 {
+		err = fmt.Errorf("client type catalog has no client types")
+		return
+	}
+
+	totWeight := 0
+	seen := make(map[string]bool)
+	for _, ct := range cat.ClientTypes {
+		if err = ct.validate(); err != nil {
+			return
+		}
+		if seen[ct.Name] {
+			err = fmt.Errorf(
+				"client type %q defined more than once",
+				ct.Name,
+			)
+			return
+		}
+		seen[ct.Name] = true
+		totWeight += ct.Weight
+	}
+
+	if totWeight <= 0 {
+		err = fmt.Errorf("client type catalog weights must sum to a positive value")
+		return
+	}
+
+	seen = make(map[string]bool)
+	for _, p := range cat.Providers {
+		if err = p.validate(); err != nil {
+			return
+		}
+		if seen[p.Name] {
+			err = fmt.Errorf(
+				"provider %q defined more than once",
+				p.Name,
+			)
+			return
+		}
+		seen[p.Name] = true
+	}
+
+	seen = make(map[string]bool)
+	for _, p := range cat.Products {
+		if err = p.validate(); err != nil {
+			return
+		}
+		if seen[p.Name] {
+			err = fmt.Errorf(
+				"product %q defined more than once",
+				p.Name,
+			)
+			return
+		}
+		seen[p.Name] = true
+	}
+
+	if err = validateExtensionSets(cat.ExtensionSets); err != nil {
+		return
+	}
+
+	// default to generating only the standard lspci format
+	if len(cat.PciFormats) == 0 {
+		cat.PciFormats = map[string]int{PCI_FORMAT_DEFAULT: 100}
+	}
+	if err = cat.ApplyPciFormatMix(cat.PciFormats); err != nil {
+		return
+	}
+
+	cat.pciDevices = make(PciDeviceTable, len(defaultPciDevices)+len(cat.PciDevices))
+	for desc, d := range defaultPciDevices {
+		cat.pciDevices[desc] = d
+	}
+	if err = cat.pciDevices.Add(cat.PciDevices); err != nil {
+		return
+	}
+
+	return
+}
+
+func LoadCatalog(catalogPath string) (cat *Catalog, err error) {
+	data, err := os.ReadFile(catalogPath)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to read client type catalog %q: %w",
+			catalogPath,
+			err,
+		)
+		return
+	}
+
+	cat, err = NewCatalog(data)
+	if err != nil {
+		err = fmt.Errorf(
+			"invalid client type catalog %q: %w",
+			catalogPath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+func DefaultCatalog() *Catalog {
+	cat, err := NewCatalog(defaultCatalogData)
+	if err != nil {
+		// the embedded catalog is part of the build so this can't happen
+		panic(fmt.Sprintf("invalid default client type catalog: %s", err.Error()))
+	}
+	return cat
+}
+
+// LoadCatalogTypes loads the catalog at the specified path, typically a
+// captured client type template, and merges it into the catalog.
+func (cat *Catalog) LoadCatalogTypes(catalogPath string) (err error) {
+	other, err := LoadCatalog(catalogPath)
+	if err != nil {
+		return
+	}
+
+	if err = cat.Merge(other); err != nil {
+		err = fmt.Errorf(
+			"failed to merge client type catalog %q: %w",
+			catalogPath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// Merge adds the client types, providers, products, PCI devices, optional
+// modules and devices, and extension sets of another catalog to the
+// catalog, failing if any of the client types, providers, products or
+// extension sets are already defined.
+func (cat *Catalog) Merge(other *Catalog) (err error) {
+	for _, ct := range other.ClientTypes {
+		if cat.Lookup(ct.Name) != nil {
+			err = fmt.Errorf(
+				"client type %q defined more than once",
+				ct.Name,
+			)
+			return
+		}
+	}
+	for _, p := range other.Providers {
+		if cat.LookupProvider(p.Name) != nil {
+			err = fmt.Errorf(
+				"provider %q defined more than once",
+				p.Name,
+			)
+			return
+		}
+	}
+
+	for _, p := range other.Products {
+		if cat.LookupProduct(p.Name) != nil {
+			err = fmt.Errorf(
+				"product %q defined more than once",
+				p.Name,
+			)
+			return
+		}
+	}
+	for _, es := range other.ExtensionSets {
+		if slices.ContainsFunc(cat.ExtensionSets, func(e *ExtensionSet) bool { return e.Name == es.Name }) {
+			err = fmt.Errorf(
+				"extension set %q defined more than once",
+				es.Name,
+			)
+			return
+		}
+	}
+
+	if err = cat.pciDevices.Add(other.PciDevices); err != nil {
+		return
+	}
+	cat.PciDevices = append(cat.PciDevices, other.PciDevices...)
+
+	cat.ClientTypes = append(cat.ClientTypes, other.ClientTypes...)
+	cat.Providers = append(cat.Providers, other.Providers...)
+	cat.Products = append(cat.Products, other.Products...)
+	cat.ExtensionSets = append(cat.ExtensionSets, other.ExtensionSets...)
+
+	for _, mod := range other.OptionalModules {
+		if !slices.Contains(cat.OptionalModules, mod) {
+			cat.OptionalModules = append(cat.OptionalModules, mod)
+		}
+	}
+	for _, dev := range other.OptionalDevices {
+		if !slices.Contains(cat.OptionalDevices, dev) {
+			cat.OptionalDevices = append(cat.OptionalDevices, dev)
+		}
+	}
+
+	return
+}
+
+func (cat *Catalog) Lookup(name string) *ClientType {
+	for _, ct := range cat.ClientTypes {
+		if ct.Name == name {
+			return ct
+		}
+	}
+	return nil
+}
+
+func (cat *Catalog) TypeNames() []string {
+	names := make([]string, 0, len(cat.ClientTypes))
+	for _, ct := range cat.ClientTypes {
+		names = append(names, ct.Name)
+	}
+	return names
+}
+
+func (cat *Catalog) Choices() []choice.Choice {
+	choices := make([]choice.Choice, 0, len(cat.ClientTypes))
+	for _, ct := range cat.ClientTypes {
+		choices = append(choices, choice.Choice{
+			Weight: ct.Weight,
+			Value:  ct,
+		})
+	}
+	return choices
+}
+
+// NewClient generates a client of a weighted choice of type, hosted by a
+// weighted choice of provider, reporting a weighted choice of pci_data
+// format, using a random source derived from the seed and client id.
+func (cat *Catalog) NewClient(id ClientId, seed int64) *Client {
+	r := NewRand(seed, id)
+	ct := choice.ChooseWith(r, cat.Choices()).(*ClientType)
+	provider := cat.chooseProvider(r, ct.HwInfo.Arch)
+	pciFormat := choice.ChooseWith(r, cat.pciFormatChoices()).(string)
+
+	c := ct.NewClient(id, provider, r)
+	c.SetPciFormat(pciFormat, cat.pciDevices)
+
+	// chosen using a separate random source, so that client types that
+	// don't vary their sizing generate the same clients, ahead of the
+	// instance data that reflects it
+	ct.setupSizing(c, sizingRand(seed, id))
+
+	if diversity.Enabled() {
+		c.diversify(cat, &diversity, seed, r)
+	}
+
+	c.setupProfiles(cat, r)
+
+	// chosen last so that catalogs without products or extension sets
+	// generate the same clients
+	c.Product = cat.chooseProduct(r, ct.HwInfo.Arch)
+	c.setupExtensions(cat, r)
+	c.setupInstanceData(seed, r)
+
+	return c
+}
+
+// ApplyMix overrides the client type weights with the specified mix,
+// with any client types not included in the mix being excluded.
+func (cat *Catalog) ApplyMix(mix map[string]int) (err error) {
+	for name := range mix {
+		if cat.Lookup(name) == nil {
+			err = fmt.Errorf(
+				"unknown client type %q in mix, must be one of: %s",
+				name,
+				strings.Join(cat.TypeNames(), ","),
+			)
+			return
+		}
+	}
+
+	totWeight := 0
+	for _, ct := range cat.ClientTypes {
+		ct.Weight = mix[ct.Name]
+		totWeight += ct.Weight
+	}
+
+	if totWeight <= 0 {
+		err = fmt.Errorf("client type mix weights must sum to a positive value")
+		return
+	}
+
+	return
+}
+
+// Mix returns the client type weights as a map keyed by type name.
+func (cat *Catalog) Mix() map[string]int {
+	mix := make(map[string]int, len(cat.ClientTypes))
+	for _, ct := range cat.ClientTypes {
+		mix[ct.Name] = ct.Weight
+	}
+	return mix
+}
+
+const (
+	DISK_CHOICES   = "disks"
+	GPU_CHOICES    = "gpus"
+	NET_CHOICES    = "nets"
+	CPU_CHOICES    = "cpus"
+	MEMORY_CHOICES = "memory"
+	SOCKET_CHOICES = "sockets"
+)
+
+// SetCountChoices overrides the named count choice table for the
+// specified client type.
+func (cat *Catalog) SetCountChoices(typeName, tableName string, choices []choice.Choice) (err error) {
+	ct := cat.Lookup(typeName)
+	if ct == nil {
+		err = fmt.Errorf(
+			"unknown client type %q, must be one of: %s",
+			typeName,
+			strings.Join(cat.TypeNames(), ","),
+		)
+		return
+	}
+
+	minValue := 0
+	if tableName == CPU_CHOICES || tableName == MEMORY_CHOICES || tableName == SOCKET_CHOICES {
+		minValue = 1
+	}
+	if err = ct.normaliseCountChoices(tableName, choices, minValue); err != nil {
+		return
+	}
+
+	switch tableName {
+	case DISK_CHOICES:
+		ct.DiskChoices = choices
+	case GPU_CHOICES:
+		ct.GPUChoices = choices
+	case NET_CHOICES:
+		ct.NetChoices = choices
+	case CPU_CHOICES:
+		ct.CpuChoices = choices
+	case MEMORY_CHOICES:
+		ct.MemoryChoices = choices
+	case SOCKET_CHOICES:
+		ct.SocketChoices = choices
+	default:
+		err = fmt.Errorf(
+			"unknown choice table %q, must be one of: %s",
+			tableName,
+			strings.Join([]string{
+				DISK_CHOICES,
+				GPU_CHOICES,
+				NET_CHOICES,
+				CPU_CHOICES,
+				MEMORY_CHOICES,
+				SOCKET_CHOICES,
+			}, ","),
+		)
+		return
+	}
+
+	return
+}
+
+// ApplyPciFormatMix overrides the pci_data format weights with the
+// specified mix, with any formats not included being excluded.
+func (cat *Catalog) ApplyPciFormatMix(mix map[string]int) (err error) {
+	totWeight := 0
+	for format, weight := range mix {
+		if !slices.Contains(PciFormats, format) {
+			err = fmt.Errorf(
+				"unknown pci_data format %q, must be one of: %s",
+				format,
+				strings.Join(PciFormats, ","),
+			)
+			return
+		}
+		if weight < 0 {
+			err = fmt.Errorf(
+				"pci_data format %q has negative weight %d",
+				format,
+				weight,
+			)
+			return
+		}
+		totWeight += weight
+	}
+
+	if totWeight <= 0 {
+		err = fmt.Errorf("pci_data format weights must sum to a positive value")
+		return
+	}
+
+	cat.PciFormats = make(map[string]int, len(mix))
+	for format, weight := range mix {
+		cat.PciFormats[format] = weight
+	}
+
+	return
+}
+
+// UsesNonDefaultPciFormats returns true if any of the pci_data formats
+// needing the PCI device table may be generated.
+func (cat *Catalog) UsesNonDefaultPciFormats() bool {
+	for format, weight := range cat.PciFormats {
+		if format != PCI_FORMAT_DEFAULT && weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// choices are built in PciFormats order to ensure reproducibility
+func (cat *Catalog) pciFormatChoices() []choice.Choice {
+	choices := make([]choice.Choice, 0, len(PciFormats))
+	for _, format := range PciFormats {
+		if weight := cat.PciFormats[format]; weight > 0 {
+			choices = append(choices, choice.Choice{
+				Weight: weight,
+				Value:  format,
+			})
+		}
+	}
+	return choices
+}
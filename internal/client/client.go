@@ -4,125 +4,66 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand"
 	"strings"
 
 	"github.com/google/uuid"
-	"github.com/rtamalin/rmt-client-testing/internal/choice"
 	"github.com/rtamalin/rmt-client-testing/internal/profile"
 )
 
 type ClientId uint32
-type ClientType uint
-
-const (
-	CLIENT_TINY ClientType = iota
-	CLIENT_SMALL
-	CLIENT_MEDIUM
-	CLIENT_LARGE
-	CLIENT_METAL
-	numClientTypes
-)
-
-var clientTypes = []string{
-	"tiny",
-	"small",
-	"medium",
-	"large",
-	"metal",
-	"UNKNOWN",
-}
-
-func (ct ClientType) String() string {
-	if ct < numClientTypes {
-		return clientTypes[ct]
-	}
-	return clientTypes[numClientTypes]
-}
 
 type Client struct {
-	Id      ClientId
-	Name    string
-	UUID    string
-	Type    ClientType
-	NumDisk int
-	NumGPU  int
-	NumNet  int
-	PciData *profile.ProfileInfo
-	ModData *profile.ProfileInfo
+	Id        ClientId
+	Name      string
+	UUID      string
+	Type      *ClientType
+	Provider  *Provider
+	NumDisk   int
+	NumGPU    int
+	NumNet    int
+	Cpus      int
+	Memory    int
+	Sockets   int
+	PciLines  []string
+	PciFormat string
+	PciData   *profile.ProfileInfo
+	ModData   *profile.ProfileInfo
+
+	// enabled data profiles, keyed by profile type
+	Profiles map[string]*profile.ProfileInfo
+
+	// base product, if any, and the extensions activated after it
+	Product      *Product
+	ExtensionSet string
+	Extensions   []string
+
+	// identity document sent by cloud instances when registering
+	InstanceData string
+
+	// generation state
+	pciSpec *PciDataSpec
+	pciBus  int
+	pciSlot int
+	modList []string
 }
 
-type ClientHwInfo struct {
-	Arch    string
-	Cpus    int
-	Memory  int
-	Sockets int
-}
+// catalog of client types used by NewClient
+var activeCatalog = DefaultCatalog()
 
-var HwInfo = []*ClientHwInfo{
-	{ // CLIENT_TINY
-		Arch:    "x86_64",
-		Cpus:    2,
-		Memory:  512,
-		Sockets: 1,
-	},
-	{ // CLIENT_SMALL
-		Arch:    "x86_64",
-		Cpus:    2,
-		Memory:  1024,
-		Sockets: 1,
-	},
-	{ // CLIENT_MEDIUM
-		Arch:    "x86_64",
-		Cpus:    2,
-		Memory:  8 * 1024,
-		Sockets: 1,
-	},
-	{ // CLIENT_LARGE
-		Arch:    "x86_64",
-		Cpus:    4,
-		Memory:  16 * 1024,
-		Sockets: 1,
-	},
-	{ // CLIENT_METAL
-		Arch:    "x86_64",
-		Cpus:    96,
-		Memory:  384 * 1024,
-		Sockets: 4,
-	},
+func SetCatalog(cat *Catalog) {
+	activeCatalog = cat
 }
 
-type newClientFunc func(ClientId) *Client
-
-var ClientChoices = [numClientTypes]choice.Choice{
-	{
-		Weight: 20,
-		Value:  newClientFunc(TinyClient),
-	},
-	{
-		Weight: 20,
-		Value:  newClientFunc(SmallClient),
-	},
-	{
-		Weight: 20,
-		Value:  newClientFunc(MediumClient),
-	},
-	{
-		Weight: 20,
-		Value:  newClientFunc(LargeClient),
-	},
-	{
-		Weight: 20,
-		Value:  newClientFunc(MetalClient),
-	},
+func ActiveCatalog() *Catalog {
+	return activeCatalog
 }
 
 func NewClient(id ClientId) *Client {
-	clientFunc := choice.Choose(ClientChoices[:]).(newClientFunc)
-
-	return clientFunc(id)
+	return activeCatalog.NewClient(id, generationSeed)
 }
 
-func (c *Client) Init(cliType ClientType, id ClientId, numDisk, numGPU, numNet int) {
+func (c *Client) Init(cliType *ClientType, id ClientId, numDisk, numGPU, numNet int, r *rand.Rand) {
 	c.Id = id
 	c.Type = cliType
 	c.NumDisk = numDisk
@@ -130,7 +71,19 @@ func (c *Client) Init(cliType ClientType, id ClientId, numDisk, numGPU, numNet i
 	c.NumNet = numNet
 
 	c.Name = fmt.Sprintf("%s-%d", cliType, id)
-	c.UUID = uuid.New().String()
+
+	// derive the UUID from the client's random source so that it is
+	// reproducible for a given seed
+	u, err := uuid.NewRandomFromReader(r)
+	if err != nil {
+		log.Fatalf(
+			"Failed to generate UUID for %s client %d: %s",
+			cliType,
+			id,
+			err.Error(),
+		)
+	}
+	c.UUID = u.String()
 }
 
 func (c *Client) Uname() string {
@@ -152,26 +105,50 @@ func (c *Client) Hostname() string {
 }
 
 const (
-	MOD_DATA_PROFILE = "mod_list"
-	PCI_DATA_PROFILE = "pci_data"
+	MOD_DATA_PROFILE = profile.MOD_LIST
+	PCI_DATA_PROFILE = profile.PCI_DATA
+	DMI_DATA_PROFILE = profile.DMI_DATA
+	BLK_DATA_PROFILE = profile.BLK_DATA
 )
 
 func (c *Client) SystemInfo() string {
+	return c.systemInfo(true)
+}
+
+// BaseSystemInfo returns the client's system information without any of
+// its data profiles.
+func (c *Client) BaseSystemInfo() string {
+	return c.systemInfo(false)
+}
+
+func (c *Client) systemInfo(withProfiles bool) string {
 	sysInfo := make(map[string]any)
-	hwInfo := HwInfo[c.Type]
+	hwInfo := c.Type.HwInfo
 
 	sysInfo["arch"] = hwInfo.Arch
-	sysInfo["cloud_provider"] = "amazon"
-	sysInfo["cpus"] = hwInfo.Cpus
+	sysInfo["cpus"] = c.Cpus
 	sysInfo["hostname"] = c.Hostname()
-	sysInfo["hypervisor"] = "amazon"
-	sysInfo["mem_total"] = hwInfo.Memory
-	sysInfo[MOD_DATA_PROFILE] = c.ModData
-	sysInfo[PCI_DATA_PROFILE] = c.PciData
-	sysInfo["sockets"] = hwInfo.Sockets
+	sysInfo["mem_total"] = c.Memory
+	sysInfo["sockets"] = c.Sockets
 	sysInfo["uname"] = c.Uname()
 	sysInfo["uuid"] = c.UUID
 
+	if withProfiles {
+		for name, pInfo := range c.Profiles {
+			sysInfo[name] = pInfo
+		}
+	}
+
+	// bare metal and on-prem clients have no cloud provider or hypervisor
+	if c.Provider != nil {
+		if c.Provider.CloudProvider != "" {
+			sysInfo["cloud_provider"] = c.Provider.CloudProvider
+		}
+		if c.Provider.Hypervisor != "" {
+			sysInfo["hypervisor"] = c.Provider.Hypervisor
+		}
+	}
+
 	siBytes, err := json.Marshal(sysInfo)
 	if err != nil {
 		log.Fatalf(
@@ -185,54 +162,75 @@ func (c *Client) SystemInfo() string {
 	return string(siBytes)
 }
 
-func (c *Client) setupPciData(header []string, pciBus, pciSlot int) {
-	// allocate pciData with capacity to hold header plus sufficent
-	// lines for the added entries
-	pciData := make([]string, 0, len(header)+c.NumDisk+c.NumGPU+c.NumNet)
+func (c *Client) setupPciData(spec *PciDataSpec) {
+	header := spec.Header
+	c.pciSpec = spec
+	c.pciBus = spec.Bus
+	c.pciSlot = spec.Slot
+
+	// allocate pciData with capacity to hold header plus the added
+	// entries
+	c.PciLines = make([]string, 0, len(header)+c.NumDisk+c.NumGPU+c.NumNet)
 
 	// copy header elements
-	pciData = append(pciData, header...)
+	c.PciLines = append(c.PciLines, header...)
 
 	// add disk devices as next slot in same bus
 	for i := 0; i < c.NumDisk; i++ {
-		pciEntry := fmt.Sprintf(
-			"%02x:%02x.0 Non-Volatile memory controller: Amazon.com, Inc. NVMe EBS Controller",
-			pciBus,
-			pciSlot,
-		)
-		pciSlot++ // increment the slot
-		pciData = append(pciData, pciEntry)
+		c.addPciDevice(spec.DiskDevice)
 	}
 
 	// add gpu devices as next slot in same bus
 	for i := 0; i < c.NumGPU; i++ {
-		pciEntry := fmt.Sprintf(
-			"%02x:%02x.0 3D controller: NVIDIA Corporation TU104GL [Tesla T4] (rev a1)",
-			pciBus,
-			pciSlot,
-		)
-		pciSlot++ // increment the slot
-		pciData = append(pciData, pciEntry)
+		c.addPciDevice(spec.GPUDevice)
 	}
 
 	// add network devices as next slot in same bus
 	for i := 0; i < c.NumNet; i++ {
-		pciEntry := fmt.Sprintf(
-			"%02x:%02x.0 Ethernet controller: Amazon.com, Inc. Elastic Network Adapter (ENA)",
-			pciBus,
-			pciSlot,
+		c.addPciDevice(spec.NetDevice)
+	}
+
+	c.SetPciFormat(PCI_FORMAT_DEFAULT, nil)
+}
+
+// add a device in the next slot of the client's PCI bus
+func (c *Client) addPciDevice(device string) {
+	pciEntry := fmt.Sprintf(
+		"%02x:%02x.0 %s",
+		c.pciBus,
+		c.pciSlot,
+		device,
+	)
+	c.pciSlot++ // increment the slot
+	c.PciLines = append(c.PciLines, pciEntry)
+}
+
+// SetPciFormat regenerates the client's pci_data in the specified format,
+// using the provided device table for the numeric formats.
+func (c *Client) SetPciFormat(format string, devices PciDeviceTable) {
+	pciData, err := devices.formatPciLines(c.PciLines, format)
+	if err != nil {
+		log.Fatalf(
+			"Failed to generate %s pci_data for %s client %d: %s",
+			format,
+			c.Type,
+			c.Id,
+			err.Error(),
 		)
-		pciSlot++ // increment the slot
-		pciData = append(pciData, pciEntry)
 	}
+	c.PciFormat = format
 
-	pciData = append(pciData, "" /* blank last line creates trailing newline */)
+	// copy the lines, adding a blank last line to create a trailing newline
+	lines := make([]string, 0, len(pciData)+1)
+	lines = append(lines, pciData...)
+	lines = append(lines, "")
 
-	c.PciData = profile.NewProfileInfo(strings.Join(pciData, "\n"))
+	c.PciData = profile.NewProfileInfo(strings.Join(lines, "\n"))
 }
 
 func (c *Client) setupModData(modList []string) {
 	ml := make([]string, len(modList))
 	copy(ml, modList)
+	c.modList = ml
 	c.ModData = profile.NewProfileInfo(ml)
 }
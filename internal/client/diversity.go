@@ -0,0 +1,336 @@
+package client
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+)
+
+// Diversity controls the random variation of the module lists and PCI
+// devices of clients of the same type.
+type Diversity struct {
+	ModAddProb    float64 `json:"modAddProb"`    // chance of adding each optional module
+	ModDropProb   float64 `json:"modDropProb"`   // chance of dropping each base module
+	DeviceAddProb float64 `json:"deviceAddProb"` // chance of adding each optional device
+
+	// if non-zero, the number of variants per client type that clients
+	// choose their variations from, limiting the unique profiles
+	VariantPool int64 `json:"variantPool"`
+}
+
+// default probabilities used when only a unique profiles target is given
+var DefaultDiversity = Diversity{
+	ModAddProb:    0.1,
+	ModDropProb:   0.02,
+	DeviceAddProb: 0.1,
+}
+
+var diversity Diversity
+
+func SetDiversity(d Diversity) {
+	diversity = d
+}
+
+func CurrentDiversity() Diversity {
+	return diversity
+}
+
+func (d *Diversity) Enabled() bool {
+	return d.ModAddProb > 0 || d.ModDropProb > 0 || d.DeviceAddProb > 0
+}
+
+func (d *Diversity) Validate() (err error) {
+	probs := []struct {
+		name  string
+		value float64
+	}{
+		{"module add", d.ModAddProb},
+		{"module drop", d.ModDropProb},
+		{"device add", d.DeviceAddProb},
+	}
+	for _, p := range probs {
+		if p.value < 0 || p.value > 1 {
+			err = fmt.Errorf(
+				"%s probability %v must be between 0 and 1",
+				p.name,
+				p.value,
+			)
+			return
+		}
+	}
+
+	if d.VariantPool < 0 {
+		err = fmt.Errorf(
+			"variant pool size %d must not be negative",
+			d.VariantPool,
+		)
+		return
+	}
+
+	return
+}
+
+// expected number of distinct values seen when drawing n times from a
+// uniform pool of the specified size
+func expectedDistinct(pool, n float64) float64 {
+	return pool * -math.Expm1(n*math.Log1p(-1/pool))
+}
+
+// outcomeClass is a class of equally likely variation outcomes, such as
+// the distinct ways of adding exactly 2 of the optional devices.
+type outcomeClass struct {
+	count float64 // number of distinct outcomes in the class
+	prob  float64 // probability of each outcome
+}
+
+// the outcome classes of independently selecting each of n items with
+// probability p, grouped by the number of items selected
+func binomialClasses(n int, p float64) []outcomeClass {
+	if n == 0 || p == 0 {
+		return []outcomeClass{{count: 1, prob: 1}}
+	}
+
+	classes := make([]outcomeClass, 0, n+1)
+	lgn, _ := math.Lgamma(float64(n + 1))
+	for k := 0; k <= n; k++ {
+		lgk, _ := math.Lgamma(float64(k + 1))
+		lgnk, _ := math.Lgamma(float64(n - k + 1))
+		classes = append(classes, outcomeClass{
+			count: math.Round(math.Exp(lgn - lgk - lgnk)),
+			prob:  math.Pow(p, float64(k)) * math.Pow(1-p, float64(n-k)),
+		})
+	}
+	return classes
+}
+
+// the outcome classes of combining two independent variations
+func combineClasses(a, b []outcomeClass) []outcomeClass {
+	classes := make([]outcomeClass, 0, len(a)*len(b))
+	for _, ca := range a {
+		for _, cb := range b {
+			classes = append(classes, outcomeClass{
+				count: ca.count * cb.count,
+				prob:  ca.prob * cb.prob,
+			})
+		}
+	}
+	return classes
+}
+
+// expected number of distinct outcomes seen when drawing m variations
+func distinctOutcomes(classes []outcomeClass, m float64) (total float64) {
+	if m <= 0 {
+		return
+	}
+	for _, c := range classes {
+		if c.prob >= 1 {
+			total += c.count
+			continue
+		}
+		total += c.count * -math.Expm1(m*math.Log1p(-c.prob))
+	}
+	return
+}
+
+// variantGroup is the expected number of clients sharing the same base
+// profile, and the outcome classes of varying that profile.
+type variantGroup struct {
+	clients  float64
+	outcomes []outcomeClass
+}
+
+// the fraction of the clients of a type expected to have each combination
+// of disk, GPU and network device counts
+func (ct *ClientType) countFractions() []float64 {
+	fractions := []float64{1}
+	for _, choices := range [][]choice.Choice{ct.DiskChoices, ct.GPUChoices, ct.NetChoices} {
+		total := 0
+		for _, c := range choices {
+			total += c.Weight
+		}
+		if total == 0 {
+			continue
+		}
+
+		var next []float64
+		for _, f := range fractions {
+			for _, c := range choices {
+				if c.Weight > 0 {
+					next = append(next, f*float64(c.Weight)/float64(total))
+				}
+			}
+		}
+		fractions = next
+	}
+	return fractions
+}
+
+// variantGroups returns the groups of clients, out of the specified
+// total, that are expected to share the same base module list, i.e. have
+// the same client type and provider, and the same base PCI data, i.e. also
+// use the same pci_data format and device counts.
+func (cat *Catalog) variantGroups(d *Diversity, numClients int64) (groups []variantGroup) {
+	typeWeight := 0
+	for _, ct := range cat.ClientTypes {
+		typeWeight += ct.Weight
+	}
+	formatWeight := 0
+	for _, c := range cat.pciFormatChoices() {
+		formatWeight += c.Weight
+	}
+	if typeWeight == 0 || formatWeight == 0 {
+		return
+	}
+
+	devOutcomes := binomialClasses(len(cat.OptionalDevices), d.DeviceAddProb)
+
+	for _, ct := range cat.ClientTypes {
+		if ct.Weight == 0 {
+			continue
+		}
+		typeCount := float64(numClients) * float64(ct.Weight) / float64(typeWeight)
+
+		// split the type's clients across the eligible providers
+		var eligible []*Provider
+		providerWeight := 0
+		for _, p := range cat.Providers {
+			if p.Supports(ct.HwInfo.Arch) {
+				eligible = append(eligible, p)
+				providerWeight += p.Weight
+			}
+		}
+		providerCounts := make(map[*Provider]float64)
+		switch {
+		case len(eligible) == 0:
+			providerCounts[nil] = typeCount
+		case providerWeight == 0:
+			providerCounts[eligible[0]] = typeCount
+		default:
+			for _, p := range eligible {
+				if p.Weight > 0 {
+					providerCounts[p] = typeCount * float64(p.Weight) / float64(providerWeight)
+				}
+			}
+		}
+
+		for p, n := range providerCounts {
+			modList := ct.modList(p)
+			numOptional := 0
+			for _, mod := range cat.OptionalModules {
+				if !slices.Contains(modList, mod) {
+					numOptional++
+				}
+			}
+			groups = append(groups, variantGroup{
+				clients: n,
+				outcomes: combineClasses(
+					binomialClasses(len(modList), d.ModDropProb),
+					binomialClasses(numOptional, d.ModAddProb),
+				),
+			})
+
+			for _, c := range cat.pciFormatChoices() {
+				for _, f := range ct.countFractions() {
+					groups = append(groups, variantGroup{
+						clients:  n * f * float64(c.Weight) / float64(formatWeight),
+						outcomes: devOutcomes,
+					})
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// VariantPoolSize determines the variant pool size that is expected to
+// result in the target number of unique mod_list and pci_data profiles
+// when generating the specified number of clients with the specified
+// diversity, along with the number of unique profiles expected with that
+// pool size. Returns a pool size of 0 if the target can't be limited by a
+// variant pool, i.e. every client should be independently varied, and a
+// pool size of 1 if even that would exceed the target, with the expected
+// number of unique profiles then being the achievable floor.
+func (cat *Catalog) VariantPoolSize(d *Diversity, target, numClients int64) (pool, unique int64) {
+	groups := cat.variantGroups(d, numClients)
+	expected := func(pool float64) (total float64) {
+		for _, g := range groups {
+			variants := g.clients
+			if pool > 0 {
+				variants = expectedDistinct(pool, g.clients)
+			}
+			total += distinctOutcomes(g.outcomes, variants)
+		}
+		return
+	}
+
+	// the number of unique profiles is limited by the number of clients
+	if expected(0) <= float64(target) {
+		return 0, int64(math.Round(expected(0)))
+	}
+
+	// bisect to find the smallest pool size reaching the target
+	lo, hi := 0.0, float64(math.MaxInt32)
+	for hi-lo > 1 {
+		mid := math.Floor((lo + hi) / 2)
+		if expected(mid) < float64(target) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return int64(hi), int64(math.Round(expected(hi)))
+}
+
+// variantRand returns the random source for a variant of a client type
+// and provider combination, shared by all such clients choosing that
+// variant.
+func variantRand(seed int64, c *Client, kind string, variant int64) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(c.Type.Name + "/" + c.Provider.String() + "/" + kind))
+	return rand.New(rand.NewSource(int64(mix64(uint64(seed) ^ h.Sum64() ^ mix64(uint64(variant))))))
+}
+
+// diversify randomly varies the client's module list and PCI devices,
+// either independently, or from a limited pool of variants for the
+// client's type and provider if a variant pool size is specified.
+func (c *Client) diversify(cat *Catalog, d *Diversity, seed int64, r *rand.Rand) {
+	modRand, devRand := r, r
+	if d.VariantPool > 0 {
+		modRand = variantRand(seed, c, "mod", r.Int63n(d.VariantPool))
+		devRand = variantRand(seed, c, "dev", r.Int63n(d.VariantPool))
+	}
+
+	// vary the module list
+	modList := make([]string, 0, len(c.modList)+len(cat.OptionalModules))
+	for _, mod := range c.modList {
+		if modRand.Float64() >= d.ModDropProb {
+			modList = append(modList, mod)
+		}
+	}
+	for _, mod := range cat.OptionalModules {
+		if modRand.Float64() < d.ModAddProb && !slices.Contains(modList, mod) {
+			modList = append(modList, mod)
+		}
+	}
+	sort.Strings(modList)
+	c.setupModData(modList)
+
+	// add optional devices in the slots following the existing devices
+	added := false
+	for _, dev := range cat.OptionalDevices {
+		if devRand.Float64() < d.DeviceAddProb {
+			c.addPciDevice(dev)
+			added = true
+		}
+	}
+	if added {
+		c.SetPciFormat(c.PciFormat, cat.pciDevices)
+	}
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+)
+
+// ExtensionSet is a named set of extensions and modules, identified by
+// their product identifiers, that clients activate after their base
+// product, with the version and arch of the base product.
+type ExtensionSet struct {
+	Name       string   `json:"name"`
+	Weight     int      `json:"weight"`
+	Extensions []string `json:"extensions"`
+}
+
+func validateExtensionSets(sets []*ExtensionSet) (err error) {
+	if len(sets) == 0 {
+		return
+	}
+
+	totWeight := 0
+	seen := make(map[string]bool)
+	for _, es := range sets {
+		if es.Name == "" {
+			err = fmt.Errorf("extension set has no name")
+			return
+		}
+		if es.Weight < 0 {
+			err = fmt.Errorf(
+				"extension set %q has negative weight %d",
+				es.Name,
+				es.Weight,
+			)
+			return
+		}
+		if seen[es.Name] {
+			err = fmt.Errorf(
+				"extension set %q defined more than once",
+				es.Name,
+			)
+			return
+		}
+		seen[es.Name] = true
+		totWeight += es.Weight
+	}
+
+	if totWeight <= 0 {
+		err = fmt.Errorf("extension set weights must sum to a positive value")
+		return
+	}
+
+	return
+}
+
+// extensionSets returns the client type's extension sets, if it has any,
+// otherwise those of the product, if it has any, otherwise the catalog's.
+func (cat *Catalog) extensionSets(ct *ClientType, p *Product) []*ExtensionSet {
+	switch {
+	case len(ct.ExtensionSets) > 0:
+		return ct.ExtensionSets
+	case p != nil && len(p.ExtensionSets) > 0:
+		return p.ExtensionSets
+	}
+	return cat.ExtensionSets
+}
+
+// setupExtensions chooses the extensions the client activates, if any
+// extension sets are defined.
+func (c *Client) setupExtensions(cat *Catalog, r *rand.Rand) {
+	sets := cat.extensionSets(c.Type, c.Product)
+	if len(sets) == 0 {
+		return
+	}
+
+	choices := make([]choice.Choice, 0, len(sets))
+	for _, es := range sets {
+		choices = append(choices, choice.Choice{Weight: es.Weight, Value: es})
+	}
+
+	es := choice.ChooseWith(r, choices).(*ExtensionSet)
+	c.ExtensionSet = es.Name
+	c.Extensions = es.Extensions
+}
@@ -0,0 +1,311 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Instance data documents mimic the shapes of those sent by PubCloud
+// clients, so that each simulated cloud instance has its own identity.
+// The signatures are random bytes, and won't verify against the real
+// cloud provider certificates.
+
+// number of accounts, subscriptions or projects, derived from the seed,
+// that a generated fleet's instances are spread across
+const instDataAccounts = 16
+
+// instances are launched at reproducible times following this epoch
+var instDataEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// audience of the GCE identity tokens
+const gceTokenAudience = "https://smt-gce.susecloud.net"
+
+var instDataRegions = map[string][]string{
+	"amazon":    {"us-east-1", "us-west-2", "eu-central-1", "eu-west-1", "ap-southeast-1"},
+	"microsoft": {"eastus", "westus2", "westeurope", "northeurope", "southeastasia"},
+	"google":    {"us-central1", "us-east1", "europe-west1", "europe-west4", "asia-southeast1"},
+}
+
+// instDataSize is a cloud provider instance size, with its memory in MiB.
+type instDataSize struct {
+	name   string
+	cpus   int
+	memory int
+}
+
+// instance sizes, in ascending order, of which the smallest covering the
+// client's CPUs and memory is used
+var instDataSizes = map[string]map[string][]instDataSize{
+	"amazon": {
+		"x86_64": {
+			{"t3.micro", 2, 1024},
+			{"t3.small", 2, 2048},
+			{"t3.medium", 2, 4096},
+			{"m5.large", 2, 8192},
+			{"m6i.xlarge", 4, 16384},
+			{"c6i.2xlarge", 8, 16384},
+			{"m6i.2xlarge", 8, 32768},
+			{"r6i.2xlarge", 8, 65536},
+			{"r6i.4xlarge", 16, 131072},
+			{"m6i.12xlarge", 48, 196608},
+			{"m6i.24xlarge", 96, 393216},
+			{"r6i.24xlarge", 96, 786432},
+			{"m7i.48xlarge", 192, 786432},
+		},
+		"aarch64": {
+			{"t4g.micro", 2, 1024},
+			{"t4g.small", 2, 2048},
+			{"t4g.medium", 2, 4096},
+			{"m6g.large", 2, 8192},
+			{"m7g.xlarge", 4, 16384},
+			{"c7g.2xlarge", 8, 16384},
+			{"m7g.2xlarge", 8, 32768},
+			{"r7g.4xlarge", 16, 131072},
+			{"m7g.16xlarge", 64, 262144},
+		},
+	},
+	"microsoft": {
+		"x86_64": {
+			{"Standard_B1s", 1, 1024},
+			{"Standard_B1ms", 1, 2048},
+			{"Standard_B2s", 2, 4096},
+			{"Standard_D2s_v5", 2, 8192},
+			{"Standard_D4s_v5", 4, 16384},
+			{"Standard_F8s_v2", 8, 16384},
+			{"Standard_E8s_v5", 8, 65536},
+			{"Standard_E16s_v5", 16, 131072},
+			{"Standard_E48s_v5", 48, 393216},
+			{"Standard_E96s_v5", 96, 688128},
+			{"Standard_M192is_v2", 192, 2097152},
+		},
+		"aarch64": {
+			{"Standard_D2pls_v5", 2, 4096},
+			{"Standard_D2ps_v5", 2, 8192},
+			{"Standard_D4ps_v5", 4, 16384},
+			{"Standard_E8ps_v5", 8, 65536},
+			{"Standard_D16ps_v5", 16, 65536},
+			{"Standard_D64ps_v5", 64, 262144},
+		},
+	},
+	"google": {
+		"x86_64": {
+			{"e2-micro", 2, 1024},
+			{"e2-small", 2, 2048},
+			{"e2-medium", 2, 4096},
+			{"n2-standard-2", 2, 8192},
+			{"n2-standard-4", 4, 16384},
+			{"c3-standard-8", 8, 32768},
+			{"n2-standard-16", 16, 65536},
+			{"n2-highmem-48", 48, 393216},
+			{"n2-highmem-96", 96, 786432},
+			{"c4-highmem-192", 192, 1523712},
+		},
+		"aarch64": {
+			{"t2a-standard-1", 1, 4096},
+			{"t2a-standard-2", 2, 8192},
+			{"t2a-standard-4", 4, 16384},
+			{"c4a-standard-8", 8, 32768},
+			{"c4a-highmem-16", 16, 131072},
+			{"c4a-standard-72", 72, 294912},
+		},
+	},
+}
+
+func randHex(r *rand.Rand, n int) string {
+	const digits = "0123456789abcdef"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = digits[r.Intn(len(digits))]
+	}
+	return string(b)
+}
+
+// randDigits returns n random decimal digits, without a leading zero.
+func randDigits(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + r.Intn(10))
+	}
+	b[0] = byte('1' + r.Intn(9))
+	return string(b)
+}
+
+func randBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+func randChoice(r *rand.Rand, values []string) string {
+	return values[r.Intn(len(values))]
+}
+
+// instDataAccount returns the random source of the account, subscription
+// or project, of the fleet determined by the seed, that the client's
+// instance belongs to, using the inverted seed so that it is unrelated to
+// the random sources of the clients.
+func instDataAccount(seed int64, r *rand.Rand) *rand.Rand {
+	return NewRand(^seed, ClientId(r.Intn(instDataAccounts)))
+}
+
+func uuidFrom(r *rand.Rand) string {
+	return uuid.Must(uuid.NewRandomFromReader(r)).String()
+}
+
+func mustMarshal(c *Client, v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Fatalf(
+			"Failed to generate instance data for %s client %s: %s",
+			c.Type,
+			c.Hostname(),
+			err.Error(),
+		)
+	}
+	return data
+}
+
+// setupInstanceData generates the client's instance data document if it
+// is hosted by a cloud provider.
+func (c *Client) setupInstanceData(seed int64, r *rand.Rand) {
+	if c.Provider == nil {
+		return
+	}
+
+	switch c.Provider.CloudProvider {
+	case "amazon":
+		c.InstanceData = c.awsInstanceData(seed, r)
+	case "microsoft":
+		c.InstanceData = c.azureInstanceData(seed, r)
+	case "google":
+		c.InstanceData = c.gceInstanceData(seed, r)
+	}
+}
+
+func launchTime(r *rand.Rand) time.Time {
+	return instDataEpoch.Add(time.Duration(r.Int63n(int64(365 * 24 * time.Hour)))).Truncate(time.Second)
+}
+
+// instance sizes used for arches a cloud provider doesn't offer, e.g. those
+// of client types added via --add-types
+const instDataGenericArch = "x86_64"
+
+// instanceSize returns the smallest instance size covering the client's
+// CPUs and memory, or the largest if none do.
+func (c *Client) instanceSize() string {
+	sizes, found := instDataSizes[c.Provider.CloudProvider][c.Type.HwInfo.Arch]
+	if !found {
+		sizes = instDataSizes[c.Provider.CloudProvider][instDataGenericArch]
+	}
+	for _, size := range sizes {
+		if size.cpus >= c.Cpus && size.memory >= c.Memory {
+			return size.name
+		}
+	}
+	return sizes[len(sizes)-1].name
+}
+
+// awsInstanceData returns an EC2 instance identity document and signature.
+func (c *Client) awsInstanceData(seed int64, r *rand.Rand) string {
+	account := instDataAccount(seed, r)
+	region := randChoice(r, instDataRegions["amazon"])
+
+	doc := map[string]any{
+		"accountId":               randDigits(account, 12),
+		"architecture":            c.Type.HwInfo.Arch,
+		"availabilityZone":        region + string(rune('a'+r.Intn(3))),
+		"billingProducts":         nil,
+		"devpayProductCodes":      nil,
+		"marketplaceProductCodes": nil,
+		"imageId":                 "ami-" + randHex(account, 17),
+		"instanceId":              "i-" + randHex(r, 17),
+		"instanceType":            c.instanceSize(),
+		"kernelId":                nil,
+		"pendingTime":             launchTime(r).Format(time.RFC3339),
+		"privateIp":               fmt.Sprintf("10.%d.%d.%d", r.Intn(256), r.Intn(256), 1+r.Intn(254)),
+		"ramdiskId":               nil,
+		"region":                  region,
+		"version":                 "2017-09-30",
+	}
+
+	return fmt.Sprintf(
+		"<document>%s</document><signature>%s</signature>",
+		mustMarshal(c, doc),
+		base64.StdEncoding.EncodeToString(randBytes(r, 128)),
+	)
+}
+
+// azureInstanceData returns an attested data document, whose PKCS7
+// signature embeds the attested VM details.
+func (c *Client) azureInstanceData(seed int64, r *rand.Rand) string {
+	account := instDataAccount(seed, r)
+	created := launchTime(r)
+
+	attested := map[string]any{
+		"licenseType":    "",
+		"nonce":          randDigits(r, 20),
+		"plan":           map[string]string{"name": "", "product": "", "publisher": ""},
+		"sku":            "gen2",
+		"subscriptionId": uuidFrom(account),
+		"timeStamp": map[string]string{
+			"createdOn": created.Format("01/02/06 15:04:05 -0700"),
+			"expiresOn": created.Add(6 * time.Hour).Format("01/02/06 15:04:05 -0700"),
+		},
+		"vmId": uuidFrom(r),
+	}
+
+	signature := append(mustMarshal(c, attested), randBytes(r, 256)...)
+	doc := map[string]string{
+		"encoding":  "pkcs7",
+		"signature": base64.StdEncoding.EncodeToString(signature),
+	}
+
+	return fmt.Sprintf("<document>%s</document>", mustMarshal(c, doc))
+}
+
+// gceInstanceData returns a full format GCE instance identity token.
+func (c *Client) gceInstanceData(seed int64, r *rand.Rand) string {
+	account := instDataAccount(seed, r)
+	projectNumber, _ := strconv.ParseInt(randDigits(account, 12), 10, 64)
+	zone := randChoice(r, instDataRegions["google"]) + "-" + string(rune('a'+r.Intn(3)))
+	created := launchTime(r)
+	issued := created.Add(time.Duration(r.Int63n(int64(24 * time.Hour)))).Truncate(time.Second)
+
+	header := map[string]string{
+		"alg": "RS256",
+		"kid": randHex(r, 40),
+		"typ": "JWT",
+	}
+	payload := map[string]any{
+		"aud": gceTokenAudience,
+		"azp": randDigits(r, 21),
+		"exp": issued.Add(time.Hour).Unix(),
+		"iat": issued.Unix(),
+		"iss": "https://accounts.google.com",
+		"sub": randDigits(r, 21),
+		"google": map[string]any{
+			"compute_engine": map[string]any{
+				"instance_creation_timestamp": created.Unix(),
+				"instance_id":                 randDigits(r, 19),
+				"instance_name":               c.Hostname(),
+				"project_id":                  "sim-project-" + randHex(account, 6),
+				"project_number":              projectNumber,
+				"zone":                        zone,
+			},
+		},
+	}
+
+	enc := base64.RawURLEncoding
+	token := enc.EncodeToString(mustMarshal(c, header)) + "." +
+		enc.EncodeToString(mustMarshal(c, payload)) + "." +
+		enc.EncodeToString(randBytes(r, 256))
+
+	return fmt.Sprintf("<document>%s</document>", token)
+}
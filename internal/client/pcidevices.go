@@ -0,0 +1,254 @@
+package client
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// table of the PCI devices used by the default catalog
+//
+//go:embed catalog/pci_devices.json
+var defaultPciDevicesData []byte
+
+// PciDevice holds the lspci names and numeric ids of a PCI device.
+type PciDevice struct {
+	Class    string `json:"class"`
+	ClassId  string `json:"classId"`
+	Vendor   string `json:"vendor"`
+	VendorId string `json:"vendorId"`
+	Device   string `json:"device"`
+	DeviceId string `json:"deviceId"`
+}
+
+// Description returns the device description as reported by lspci.
+func (d *PciDevice) Description() string {
+	return fmt.Sprintf("%s: %s %s", d.Class, d.Vendor, d.Device)
+}
+
+func (d *PciDevice) validate() (err error) {
+	ids := []struct {
+		name  string
+		value string
+	}{
+		{"classId", d.ClassId},
+		{"vendorId", d.VendorId},
+		{"deviceId", d.DeviceId},
+	}
+	for _, id := range ids {
+		if !pciIdRe.MatchString(id.value) {
+			err = fmt.Errorf(
+				"PCI device %q has invalid %s %q, must be 4 hex digits",
+				d.Description(),
+				id.name,
+				id.value,
+			)
+			return
+		}
+	}
+
+	return
+}
+
+var pciIdRe = regexp.MustCompile(`^[0-9a-f]{4}$`)
+
+// PciDeviceTable maps lspci device descriptions to the device's details.
+type PciDeviceTable map[string]*PciDevice
+
+func (t PciDeviceTable) Add(devices []*PciDevice) (err error) {
+	for _, d := range devices {
+		if err = d.validate(); err != nil {
+			return
+		}
+		t[d.Description()] = d
+	}
+	return
+}
+
+func (t PciDeviceTable) Lookup(description string) *PciDevice {
+	return t[description]
+}
+
+var defaultPciDevices = func() PciDeviceTable {
+	var table struct {
+		PciDevices []*PciDevice `json:"pciDevices"`
+	}
+	if err := json.Unmarshal(defaultPciDevicesData, &table); err != nil {
+		panic(fmt.Sprintf("invalid default PCI device table: %s", err.Error()))
+	}
+
+	t := make(PciDeviceTable)
+	if err := t.Add(table.PciDevices); err != nil {
+		panic(fmt.Sprintf("invalid default PCI device table: %s", err.Error()))
+	}
+	return t
+}()
+
+// Supported pci_data formats, matching the output of the equivalent
+// lspci command.
+const (
+	PCI_FORMAT_DEFAULT = "lspci"
+	PCI_FORMAT_N       = "lspci-n"
+	PCI_FORMAT_NN      = "lspci-nn"
+	PCI_FORMAT_VMM     = "lspci-vmm"
+)
+
+var PciFormats = []string{
+	PCI_FORMAT_DEFAULT,
+	PCI_FORMAT_N,
+	PCI_FORMAT_NN,
+	PCI_FORMAT_VMM,
+}
+
+// split an lspci line into its slot, description and revision
+var pciLineRe = regexp.MustCompile(`^(\S+) (.*?)(?: \(rev ([0-9a-f]{2})\))?$`)
+
+type pciEntry struct {
+	slot        string
+	description string
+	rev         string
+}
+
+func parsePciLine(line string) (entry pciEntry, err error) {
+	match := pciLineRe.FindStringSubmatch(line)
+	if match == nil {
+		err = fmt.Errorf("invalid lspci line %q", line)
+		return
+	}
+
+	entry.slot = match[1]
+	entry.description = match[2]
+	entry.rev = match[3]
+
+	return
+}
+
+// className returns the class name without any appended class id, as
+// lspci includes the id in the name of unassigned/unclassified classes
+func className(d *PciDevice) string {
+	return strings.TrimSuffix(d.Class, " ["+d.ClassId+"]")
+}
+
+// formatPciLines converts lspci lines to the specified lspci format,
+// returning the lines that make up the formatted output.
+func (t PciDeviceTable) formatPciLines(lines []string, format string) (formatted []string, err error) {
+	if format == PCI_FORMAT_DEFAULT {
+		formatted = lines
+		return
+	}
+
+	formatted = make([]string, 0, len(lines))
+	for _, line := range lines {
+		var entry pciEntry
+		if entry, err = parsePciLine(line); err != nil {
+			return
+		}
+
+		d := t.Lookup(entry.description)
+		if d == nil {
+			err = fmt.Errorf(
+				"no PCI device table entry for %q",
+				entry.description,
+			)
+			return
+		}
+
+		rev := ""
+		if entry.rev != "" {
+			rev = " (rev " + entry.rev + ")"
+		}
+
+		switch format {
+		case PCI_FORMAT_N:
+			formatted = append(formatted, fmt.Sprintf(
+				"%s %s: %s:%s%s",
+				entry.slot,
+				d.ClassId,
+				d.VendorId,
+				d.DeviceId,
+				rev,
+			))
+		case PCI_FORMAT_NN:
+			formatted = append(formatted, fmt.Sprintf(
+				"%s %s [%s]: %s %s [%s:%s]%s",
+				entry.slot,
+				className(d),
+				d.ClassId,
+				d.Vendor,
+				d.Device,
+				d.VendorId,
+				d.DeviceId,
+				rev,
+			))
+		case PCI_FORMAT_VMM:
+			formatted = append(formatted,
+				"Slot:\t"+entry.slot,
+				"Class:\t"+className(d),
+				"Vendor:\t"+d.Vendor,
+				"Device:\t"+d.Device,
+			)
+			if entry.rev != "" {
+				formatted = append(formatted, "Rev:\t"+entry.rev)
+			}
+			// records are separated by a blank line
+			formatted = append(formatted, "")
+		default:
+			err = fmt.Errorf(
+				"unsupported pci_data format %q, must be one of: %s",
+				format,
+				strings.Join(PciFormats, ","),
+			)
+			return
+		}
+	}
+
+	return
+}
+
+// CheckPciDevices returns the sorted list of device descriptions used by
+// the catalog that have no PCI device table entry.
+func (cat *Catalog) CheckPciDevices() (missing []string) {
+	var lines []string
+	addSpec := func(spec *PciDataSpec) {
+		lines = append(lines, spec.Header...)
+		for _, dev := range []string{spec.DiskDevice, spec.GPUDevice, spec.NetDevice} {
+			if dev != "" {
+				lines = append(lines, "00:00.0 "+dev)
+			}
+		}
+	}
+
+	for _, ct := range cat.ClientTypes {
+		addSpec(&ct.PciData)
+	}
+	for _, p := range cat.Providers {
+		for _, platform := range p.Platforms {
+			if platform.PciData != nil {
+				addSpec(platform.PciData)
+			}
+		}
+	}
+	for _, dev := range cat.OptionalDevices {
+		lines = append(lines, "00:00.0 "+dev)
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		entry, err := parsePciLine(line)
+		if err != nil {
+			entry.description = line
+		} else if cat.pciDevices.Lookup(entry.description) != nil {
+			continue
+		}
+		if !seen[entry.description] {
+			seen[entry.description] = true
+			missing = append(missing, entry.description)
+		}
+	}
+	sort.Strings(missing)
+
+	return
+}
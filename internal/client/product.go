@@ -0,0 +1,144 @@
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+)
+
+// Product is a base product that simulated clients register with.
+type Product struct {
+	Name       string `json:"name"`
+	Weight     int    `json:"weight"`
+	Identifier string `json:"identifier"`
+	Version    string `json:"version"`
+
+	// if specified, the product is only available for these arches
+	Arches []string `json:"arches,omitempty"`
+
+	// if specified, overrides the catalog's extension sets
+	ExtensionSets []*ExtensionSet `json:"extensionSets,omitempty"`
+}
+
+func (p *Product) String() string {
+	if p == nil {
+		return "none"
+	}
+	return p.Name
+}
+
+func (p *Product) Supports(arch string) bool {
+	return len(p.Arches) == 0 || slices.Contains(p.Arches, arch)
+}
+
+func (p *Product) validate() (err error) {
+	if p.Name == "" {
+		err = fmt.Errorf("product has no name")
+		return
+	}
+
+	if p.Weight < 0 {
+		err = fmt.Errorf(
+			"product %q has negative weight %d",
+			p.Name,
+			p.Weight,
+		)
+		return
+	}
+
+	if p.Identifier == "" || p.Version == "" {
+		err = fmt.Errorf(
+			"product %q must specify an identifier and version",
+			p.Name,
+		)
+		return
+	}
+
+	if err = validateExtensionSets(p.ExtensionSets); err != nil {
+		err = fmt.Errorf(
+			"product %q: %w",
+			p.Name,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// choose a product, for a client of the specified arch, from the products
+// available for that arch, falling back to the first such product if none
+// of them have a positive weight.
+func (cat *Catalog) chooseProduct(r *rand.Rand, arch string) *Product {
+	var eligible []choice.Choice
+	totWeight := 0
+	for _, p := range cat.Products {
+		if !p.Supports(arch) {
+			continue
+		}
+		eligible = append(eligible, choice.Choice{
+			Weight: p.Weight,
+			Value:  p,
+		})
+		totWeight += p.Weight
+	}
+
+	switch {
+	case len(eligible) == 0:
+		return nil
+	case totWeight == 0:
+		return eligible[0].Value.(*Product)
+	}
+
+	return choice.ChooseWith(r, eligible).(*Product)
+}
+
+func (cat *Catalog) LookupProduct(name string) *Product {
+	for _, p := range cat.Products {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (cat *Catalog) ProductNames() []string {
+	names := make([]string, 0, len(cat.Products))
+	for _, p := range cat.Products {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// ApplyProductMix overrides the product weights with the specified mix,
+// with any products not included in the mix being given a weight of 0.
+func (cat *Catalog) ApplyProductMix(mix map[string]int) (err error) {
+	for name := range mix {
+		if cat.LookupProduct(name) == nil {
+			err = fmt.Errorf(
+				"unknown product %q in mix, must be one of: %s",
+				name,
+				strings.Join(cat.ProductNames(), ","),
+			)
+			return
+		}
+	}
+
+	for _, p := range cat.Products {
+		p.Weight = mix[p.Name]
+	}
+
+	return
+}
+
+// ProductMix returns the product weights as a map keyed by name.
+func (cat *Catalog) ProductMix() map[string]int {
+	mix := make(map[string]int, len(cat.Products))
+	for _, p := range cat.Products {
+		mix[p.Name] = p.Weight
+	}
+	return mix
+}
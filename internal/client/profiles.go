@@ -0,0 +1,226 @@
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+	"github.com/rtamalin/rmt-client-testing/internal/profile"
+)
+
+// ProfileGenerator generates a client's data profile of a given type,
+// using the client's random source for any random choices.
+type ProfileGenerator func(c *Client, cat *Catalog, r *rand.Rand) *profile.ProfileInfo
+
+type profileGenerator struct {
+	name     string
+	generate ProfileGenerator
+}
+
+// registered profile generators, in registration order, which is the
+// order in which a client's profiles are generated
+var profileGenerators []profileGenerator
+
+// RegisterProfileType registers a generator for the named profile type,
+// also registering the profile type itself so that it is recognised as
+// a data profile by the consumers of the generated system info.
+func RegisterProfileType(name string, gen ProfileGenerator) {
+	for i := range profileGenerators {
+		if profileGenerators[i].name == name {
+			profileGenerators[i].generate = gen
+			return
+		}
+	}
+	profileGenerators = append(profileGenerators, profileGenerator{name, gen})
+	profile.Register(name)
+}
+
+func lookupProfileGenerator(name string) ProfileGenerator {
+	for _, pg := range profileGenerators {
+		if pg.name == name {
+			return pg.generate
+		}
+	}
+	return nil
+}
+
+// ProfileTypeNames returns the names of the profile types that can be
+// generated, in registration order.
+func ProfileTypeNames() []string {
+	names := make([]string, 0, len(profileGenerators))
+	for _, pg := range profileGenerators {
+		names = append(names, pg.name)
+	}
+	return names
+}
+
+// profile types included in the generated system info
+var enabledProfiles = []string{
+	MOD_DATA_PROFILE,
+	PCI_DATA_PROFILE,
+}
+
+// SetProfileTypes specifies the profile types to generate for each client.
+func SetProfileTypes(names []string) (err error) {
+	for _, name := range names {
+		if lookupProfileGenerator(name) == nil {
+			err = fmt.Errorf(
+				"unknown profile type %q, must be one of: %s",
+				name,
+				strings.Join(ProfileTypeNames(), ","),
+			)
+			return
+		}
+	}
+
+	// generate the profiles in registration order for reproducibility
+	enabledProfiles = make([]string, 0, len(names))
+	for _, name := range ProfileTypeNames() {
+		for _, enabled := range names {
+			if name == enabled {
+				enabledProfiles = append(enabledProfiles, name)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+func ProfileTypes() []string {
+	return append([]string(nil), enabledProfiles...)
+}
+
+// setupProfiles generates the client's enabled data profiles.
+func (c *Client) setupProfiles(cat *Catalog, r *rand.Rand) {
+	c.Profiles = make(map[string]*profile.ProfileInfo, len(enabledProfiles))
+	for _, name := range enabledProfiles {
+		c.Profiles[name] = lookupProfileGenerator(name)(c, cat, r)
+	}
+}
+
+func init() {
+	// the pci_data and mod_list profiles are generated along with the
+	// client's hardware, as other settings, e.g. diversity, affect them
+	RegisterProfileType(MOD_DATA_PROFILE, func(c *Client, cat *Catalog, r *rand.Rand) *profile.ProfileInfo {
+		return c.ModData
+	})
+	RegisterProfileType(PCI_DATA_PROFILE, func(c *Client, cat *Catalog, r *rand.Rand) *profile.ProfileInfo {
+		return c.PciData
+	})
+	RegisterProfileType(DMI_DATA_PROFILE, dmiProfile)
+	RegisterProfileType(BLK_DATA_PROFILE, blkProfile)
+}
+
+// DmiInfo holds the DMI system identification details reported by the
+// clients hosted by a provider.
+type DmiInfo struct {
+	SysVendor   string `json:"sysVendor"`
+	ProductName string `json:"productName"`
+	BiosVendor  string `json:"biosVendor"`
+	BiosVersion string `json:"biosVersion"`
+}
+
+// DMI details reported by clients whose provider doesn't specify any
+var defaultDmiInfo = DmiInfo{
+	SysVendor:   "QEMU",
+	ProductName: "Standard PC (i440FX + PIIX, 1996)",
+	BiosVendor:  "SeaBIOS",
+	BiosVersion: "1.16.3",
+}
+
+// dmiProfile generates a summary of the client's DMI system identification,
+// as NAME: VALUE lines named after the associated /sys/class/dmi/id entries,
+// which will be empty for arches that don't support DMI.
+func dmiProfile(c *Client, cat *Catalog, r *rand.Rand) *profile.ProfileInfo {
+	switch c.Type.HwInfo.Arch {
+	case "ppc64le", "s390x":
+		return profile.NewProfileInfo("")
+	}
+
+	dmi := &defaultDmiInfo
+	if c.Provider != nil && c.Provider.Dmi != nil {
+		dmi = c.Provider.Dmi
+	}
+
+	lines := []string{
+		"bios_vendor: " + dmi.BiosVendor,
+		"bios_version: " + dmi.BiosVersion,
+		"product_name: " + dmi.ProductName,
+		"sys_vendor: " + dmi.SysVendor,
+		"", // trailing newline
+	}
+
+	return profile.NewProfileInfo(strings.Join(lines, "\n"))
+}
+
+// kernel style letter suffix of the i'th disk, i.e. a-z, then aa-zz, etc
+func diskLetters(i int) (letters string) {
+	for n := i + 1; n > 0; n = (n - 1) / 26 {
+		letters = string(rune('a'+(n-1)%26)) + letters
+	}
+	return
+}
+
+// name of the i'th disk, based on the kind of the client's disk device
+func (c *Client) diskName(i int) string {
+	device := c.pciSpec.DiskDevice
+	switch {
+	case c.Type.HwInfo.Arch == "s390x":
+		return "dasd" + diskLetters(i)
+	case strings.HasPrefix(device, "Non-Volatile memory controller"):
+		return fmt.Sprintf("nvme%dn1", i)
+	case strings.Contains(device, "Virtio block device"):
+		return "vd" + diskLetters(i)
+	default:
+		return "sd" + diskLetters(i)
+	}
+}
+
+// size of the boot partition on the root disk
+const bootPartSize = 512 << 20
+
+// mount point of the boot partition, with ppc64le's PReP boot partition
+// not being mounted
+func (c *Client) bootMount() string {
+	switch c.Type.HwInfo.Arch {
+	case "ppc64le":
+		return ""
+	case "s390x":
+		return "/boot/zipl"
+	default:
+		return "/boot/efi"
+	}
+}
+
+// blkProfile generates the client's block device layout, matching the
+// output of `lsblk -b -r -n -o NAME,SIZE,TYPE,MOUNTPOINT`, with the first
+// disk being partitioned as the root disk, if large enough.
+func blkProfile(c *Client, cat *Catalog, r *rand.Rand) *profile.ProfileInfo {
+	// every client has at least a root disk
+	numDisk := max(c.NumDisk, 1)
+
+	lines := make([]string, 0, numDisk+3)
+	for i := 0; i < numDisk; i++ {
+		name := c.diskName(i)
+		size := int64(choice.ChooseWith(r, c.Type.DiskSizeChoices).(int)) << 30
+		lines = append(lines, fmt.Sprintf("%s %d disk ", name, size))
+
+		if i == 0 && size > bootPartSize {
+			part := name
+			if strings.HasPrefix(name, "nvme") {
+				part += "p"
+			}
+			lines = append(lines,
+				fmt.Sprintf("%s1 %d part %s", part, bootPartSize, c.bootMount()),
+				fmt.Sprintf("%s2 %d part /", part, size-bootPartSize),
+			)
+		}
+	}
+
+	// add a blank last line to create a trailing newline
+	lines = append(lines, "")
+
+	return profile.NewProfileInfo(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,280 @@
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rtamalin/rmt-client-testing/internal/choice"
+)
+
+// ProviderPlatform specifies how a provider alters the hardware of a
+// client type for a given arch.
+type ProviderPlatform struct {
+	// if specified, the header entries are layered onto the client type's
+	// header, replacing those at the same addresses, and the bus and slot
+	// replace those of the client type, as do any specified device strings
+	PciData        *PciDataSpec `json:"pciData,omitempty"`
+	ModList        []string     `json:"modList,omitempty"`
+	ExcludeModules []string     `json:"excludeModules,omitempty"`
+
+	// client type header entries whose device strings contain any of these
+	// are excluded, e.g. the devices of the client type's own hypervisor
+	ExcludeDevices []string `json:"excludeDevices,omitempty"`
+}
+
+// Provider is a cloud provider or hypervisor hosting simulated clients.
+type Provider struct {
+	Name          string `json:"name"`
+	Weight        int    `json:"weight"`
+	CloudProvider string `json:"cloudProvider,omitempty"`
+	Hypervisor    string `json:"hypervisor,omitempty"`
+
+	// DMI details reported by hosted clients, if not the generic defaults
+	Dmi *DmiInfo `json:"dmi,omitempty"`
+
+	// a provider can only host clients of the arches it has platforms for
+	Platforms map[string]*ProviderPlatform `json:"platforms"`
+}
+
+func (p *Provider) String() string {
+	if p == nil {
+		return "none"
+	}
+	return p.Name
+}
+
+func (p *Provider) Supports(arch string) bool {
+	_, found := p.Platforms[arch]
+	return found
+}
+
+func (p *Provider) validate() (err error) {
+	if p.Name == "" {
+		err = fmt.Errorf("provider has no name")
+		return
+	}
+
+	if p.Weight < 0 {
+		err = fmt.Errorf(
+			"provider %q has negative weight %d",
+			p.Name,
+			p.Weight,
+		)
+		return
+	}
+
+	if len(p.Platforms) == 0 {
+		err = fmt.Errorf(
+			"provider %q has no platforms",
+			p.Name,
+		)
+		return
+	}
+
+	// treat null platform entries as using the client type's hardware
+	for arch, platform := range p.Platforms {
+		if platform == nil {
+			p.Platforms[arch] = new(ProviderPlatform)
+		}
+	}
+
+	return
+}
+
+// choose a provider, for a client of the specified arch, from the
+// providers that support that arch, falling back to the first such
+// provider if none of them have a positive weight.
+func (cat *Catalog) chooseProvider(r *rand.Rand, arch string) *Provider {
+	var eligible []choice.Choice
+	totWeight := 0
+	for _, p := range cat.Providers {
+		if !p.Supports(arch) {
+			continue
+		}
+		eligible = append(eligible, choice.Choice{
+			Weight: p.Weight,
+			Value:  p,
+		})
+		totWeight += p.Weight
+	}
+
+	switch {
+	case len(eligible) == 0:
+		return nil
+	case totWeight == 0:
+		return eligible[0].Value.(*Provider)
+	}
+
+	return choice.ChooseWith(r, eligible).(*Provider)
+}
+
+func (cat *Catalog) LookupProvider(name string) *Provider {
+	for _, p := range cat.Providers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (cat *Catalog) ProviderNames() []string {
+	names := make([]string, 0, len(cat.Providers))
+	for _, p := range cat.Providers {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// ApplyProviderMix overrides the provider weights with the specified
+// mix, with any providers not included in the mix being given a weight
+// of 0.
+func (cat *Catalog) ApplyProviderMix(mix map[string]int) (err error) {
+	for name := range mix {
+		if cat.LookupProvider(name) == nil {
+			err = fmt.Errorf(
+				"unknown provider %q in mix, must be one of: %s",
+				name,
+				strings.Join(cat.ProviderNames(), ","),
+			)
+			return
+		}
+	}
+
+	for _, p := range cat.Providers {
+		p.Weight = mix[p.Name]
+	}
+
+	return
+}
+
+// ProviderMix returns the provider weights as a map keyed by name.
+func (cat *Catalog) ProviderMix() map[string]int {
+	mix := make(map[string]int, len(cat.Providers))
+	for _, p := range cat.Providers {
+		mix[p.Name] = p.Weight
+	}
+	return mix
+}
+
+// pciDataSpec returns the client type's PCI data spec as modified by the
+// provider's platform for the client type's arch.
+func (ct *ClientType) pciDataSpec(p *Provider) *PciDataSpec {
+	if p == nil || p.Platforms[ct.HwInfo.Arch].PciData == nil {
+		return &ct.PciData
+	}
+
+	platform := p.Platforms[ct.HwInfo.Arch]
+	override := platform.PciData
+	spec := ct.PciData
+	spec.Header = layerPciHeader(ct.PciData.Header, override, platform.ExcludeDevices)
+	spec.Bus = override.Bus
+	spec.Slot = override.Slot
+	if override.DiskDevice != "" {
+		spec.DiskDevice = override.DiskDevice
+	}
+	if override.GPUDevice != "" {
+		spec.GPUDevice = override.GPUDevice
+	}
+	if override.NetDevice != "" {
+		spec.NetDevice = override.NetDevice
+	}
+
+	return &spec
+}
+
+// pciEntryAddress returns the bus:slot.func address of a PCI header entry,
+// ignoring any domain prefix.
+func pciEntryAddress(entry string) string {
+	addr, _, _ := strings.Cut(entry, " ")
+	return addr[max(len(addr)-7, 0):]
+}
+
+// the chipset bridge classes of a platform, which a provider's header
+// entries of the same class replace
+var pciPlatformClasses = []string{"Host bridge", "ISA bridge"}
+
+// pciEntryClass returns the device class of a PCI header entry.
+func pciEntryClass(entry string) string {
+	_, device, _ := strings.Cut(entry, " ")
+	class, _, _ := strings.Cut(device, ": ")
+	return class
+}
+
+// layerPciHeader layers the provider's header entries onto the client
+// type's header, dropping the client type's entries at the same addresses,
+// its chipset bridges if the provider has its own, those whose device
+// strings contain any of the excluded devices, and those in the slots of
+// the provider's bus that the added devices will occupy, returning the
+// entries ordered by address, as lspci lists them.
+func layerPciHeader(header []string, override *PciDataSpec, excludeDevices []string) []string {
+	replaced := make(map[string]bool, len(override.Header))
+	for _, entry := range override.Header {
+		replaced[pciEntryAddress(entry)] = true
+		if class := pciEntryClass(entry); slices.Contains(pciPlatformClasses, class) {
+			replaced[class] = true
+		}
+	}
+
+	layered := make([]string, 0, len(header)+len(override.Header))
+	for _, entry := range header {
+		addr := pciEntryAddress(entry)
+		if replaced[addr] || replaced[pciEntryClass(entry)] {
+			continue
+		}
+
+		var bus, slot int
+		if _, err := fmt.Sscanf(addr, "%02x:%02x", &bus, &slot); err == nil &&
+			bus == override.Bus && slot >= override.Slot {
+			continue
+		}
+
+		_, device, _ := strings.Cut(entry, " ")
+		if slices.ContainsFunc(excludeDevices, func(exclude string) bool {
+			return strings.Contains(device, exclude)
+		}) {
+			continue
+		}
+
+		layered = append(layered, entry)
+	}
+	layered = append(layered, override.Header...)
+
+	slices.SortStableFunc(layered, func(a, b string) int {
+		return strings.Compare(pciEntryAddress(a), pciEntryAddress(b))
+	})
+
+	return layered
+}
+
+// modList returns the client type's module list as modified by the
+// provider's platform for the client type's arch.
+func (ct *ClientType) modList(p *Provider) []string {
+	if p == nil {
+		return ct.ModList
+	}
+
+	platform := p.Platforms[ct.HwInfo.Arch]
+	if len(platform.ModList) == 0 && len(platform.ExcludeModules) == 0 {
+		return ct.ModList
+	}
+
+	modList := make([]string, 0, len(ct.ModList)+len(platform.ModList))
+	for _, mod := range ct.ModList {
+		if !slices.Contains(platform.ExcludeModules, mod) {
+			modList = append(modList, mod)
+		}
+	}
+	for _, mod := range platform.ModList {
+		if !slices.Contains(modList, mod) {
+			modList = append(modList, mod)
+		}
+	}
+
+	// lsmod based module lists are sorted
+	sort.Strings(modList)
+
+	return modList
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+)
+
+// seed from which each client's random source is derived
+var generationSeed = time.Now().UnixNano()
+
+func SetSeed(seed int64) {
+	generationSeed = seed
+}
+
+func Seed() int64 {
+	return generationSeed
+}
+
+// splitmix64 finaliser, used to spread the bits of the seed and client id
+// so that adjacent ids produce unrelated random sequences
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// sizingRand returns the random source used to choose the client's sizing,
+// determined by the seed and client id, but independent of the client's
+// other choices.
+func sizingRand(seed int64, id ClientId) *rand.Rand {
+	return NewRand(int64(mix64(uint64(seed))), id)
+}
+
+// NewRand returns a random source that is determined solely by the seed
+// and client id, making a client's generation independent of the order
+// in which clients are generated.
+func NewRand(seed int64, id ClientId) *rand.Rand {
+	clientSeed := mix64(uint64(seed) ^ mix64(uint64(id)))
+	return rand.New(rand.NewSource(int64(clientSeed)))
+}
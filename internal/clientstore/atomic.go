@@ -0,0 +1,73 @@
+package clientstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes data to a temporary file in the same directory
+// as filePath, which is renamed to filePath once complete, so that an
+// interrupted write leaves any existing file intact rather than truncated.
+// If sync is true the file, and the directory holding it, are synced to
+// stable storage before returning.
+func writeFileAtomic(filePath string, data []byte, perm os.FileMode, sync bool) (err error) {
+	dirPath, fileName := filepath.Split(filePath)
+
+	// temporary files are hidden so that they are skipped by walks
+	f, err := os.CreateTemp(dirPath, "."+fileName+".tmp*")
+	if err != nil {
+		return
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil && sync {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filePath)
+	}
+	if err != nil {
+		// remove the temporary file, ignoring the error
+		_ = os.Remove(tmpPath)
+		return
+	}
+
+	if sync {
+		err = syncDir(dirPath)
+	}
+
+	return
+}
+
+// syncDir syncs a directory, persisting the entries created, renamed or
+// removed within it.
+func syncDir(dirPath string) (err error) {
+	if dirPath == "" {
+		dirPath = "."
+	}
+
+	d, err := os.Open(dirPath)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil {
+		err = fmt.Errorf(
+			"failed to sync directory %q: %w",
+			dirPath,
+			err,
+		)
+		return
+	}
+
+	return
+}
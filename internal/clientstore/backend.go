@@ -0,0 +1,48 @@
+package clientstore
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	BACKEND_DIR  = "dir"
+	BACKEND_PACK = "pack"
+)
+
+var Backends = []string{BACKEND_DIR, BACKEND_PACK}
+
+// Backend stores the files of the clients in a datastore, identified by
+// the client's id and the type of file, and must be safe for concurrent
+// use.
+type Backend interface {
+	Name() string
+	WriteFile(id FileId, fileType FileType, data []byte, perm os.FileMode) error
+	ReadFile(id FileId, fileType FileType) ([]byte, error)
+	Delete(id FileId, fileType FileType) error
+	Exists(id FileId, fileType FileType) bool
+	MaxFileId(fileType FileType) (id FileId, found bool, err error)
+
+	// Walk calls fn for each file in the datastore, in ascending id order,
+	// stopping if fn returns an error.
+	Walk(fn func(id FileId, fileType FileType) error) error
+
+	// SetSync controls whether each write is synced to stable storage
+	// before it returns, the default, or only when the backend is closed.
+	SetSync(sync bool)
+
+	Close() error
+}
+
+// fileTypeOf returns the type of a client file name, as generated by
+// FileId.FileName(), with ok being false for other names.
+func fileTypeOf(name string) (fileType FileType, ok bool) {
+	for _, ext := range []string{".json", ".xml"} {
+		if base, found := strings.CutSuffix(name, ext); found && base != "" {
+			fileType = FileType(base)
+			ok = FileId(0).FileName(fileType) == name
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,57 @@
+package clientstore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ClientInfo holds the generation details of a client that aren't part
+// of its system information, stored alongside it in the datastore.
+type ClientInfo struct {
+	Type         string       `json:"type"`
+	Provider     string       `json:"provider"`
+	Product      *ProductInfo `json:"product,omitempty"`
+	ExtensionSet string       `json:"extensionSet,omitempty"`
+	Extensions   []string     `json:"extensions,omitempty"`
+}
+
+// ProductInfo identifies the base product assigned to a client.
+type ProductInfo struct {
+	Name       string `json:"name"`
+	Identifier string `json:"identifier"`
+	Version    string `json:"version"`
+}
+
+func (s *ClientStore) ReadClientInfo(id FileId) (ci *ClientInfo, err error) {
+	data, err := s.ReadFile(id, CLIENT_INFO_TYPE)
+	if err != nil {
+		return
+	}
+
+	ci = new(ClientInfo)
+	if err = json.Unmarshal(data, ci); err != nil {
+		err = fmt.Errorf(
+			"failed to json.Unmarshal() client info %q: %w",
+			id.Path(CLIENT_INFO_TYPE),
+			err,
+		)
+		ci = nil
+		return
+	}
+
+	return
+}
+
+func (s *ClientStore) WriteClientInfo(id FileId, ci *ClientInfo) (err error) {
+	data, err := json.Marshal(ci)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to json.Marshal() client info for %q: %w",
+			id.Path(CLIENT_INFO_TYPE),
+			err,
+		)
+		return
+	}
+
+	return s.WriteFile(id, CLIENT_INFO_TYPE, data, 0o644)
+}
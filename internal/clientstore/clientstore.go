@@ -7,6 +7,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 
 	"golang.org/x/sys/unix"
 )
@@ -14,8 +17,10 @@ import (
 type FileType string
 
 const (
-	SYS_INFO_TYPE FileType = "sysinfo"
-	REG_INFO_TYPE FileType = "reginfo"
+	SYS_INFO_TYPE    FileType = "sysinfo"
+	REG_INFO_TYPE    FileType = "reginfo"
+	CLIENT_INFO_TYPE FileType = "clientinfo"
+	INST_DATA_TYPE   FileType = "instdata"
 )
 
 type FileId uint32
@@ -41,6 +46,10 @@ func (i FileId) DirPath() string {
 }
 
 func (i FileId) FileName(fileType FileType) string {
+	// instance data documents are XML rather than JSON
+	if fileType == INST_DATA_TYPE {
+		return fmt.Sprintf("%s.xml", fileType)
+	}
 	return fmt.Sprintf("%s.json", fileType)
 }
 
@@ -52,7 +61,17 @@ func (i FileId) Path(fileType FileType) string {
 }
 
 type ClientStore struct {
-	rootDir string
+	rootDir  string
+	backend  Backend
+	noSync   bool
+	compress bool
+	journal  journal
+	lock     storeLock
+
+	// total sizes of the client files written, before and after any
+	// compression
+	logicalBytes atomic.Int64
+	storedBytes  atomic.Int64
 }
 
 func New(rootPath string) *ClientStore {
@@ -114,12 +133,68 @@ func (s *ClientStore) Init(rootPath string) {
 	}
 
 	s.rootDir = rootPath
+	s.backend = newDirBackend(rootPath)
+}
+
+// NewWithBackend returns a ClientStore for rootPath that stores the client
+// files using the named backend.
+func NewWithBackend(rootPath, backendName string) (s *ClientStore, err error) {
+	s = New(rootPath)
+	if err = s.UseBackend(backendName); err != nil {
+		s = nil
+	}
+	return
+}
+
+// ValidateBackend checks that the named backend is supported.
+func ValidateBackend(backendName string) (err error) {
+	if !slices.Contains(Backends, backendName) {
+		err = fmt.Errorf(
+			"unknown datastore backend %q, must be one of: %s",
+			backendName,
+			strings.Join(Backends, ","),
+		)
+		return
+	}
+
+	return
+}
+
+// UseBackend switches the ClientStore to storing the client files using
+// the named backend, closing the current one.
+func (s *ClientStore) UseBackend(backendName string) (err error) {
+	if err = ValidateBackend(backendName); err != nil {
+		return
+	}
+	if backendName == s.backend.Name() {
+		return
+	}
+
+	var backend Backend
+	switch backendName {
+	case BACKEND_DIR:
+		backend = newDirBackend(s.rootDir)
+	case BACKEND_PACK:
+		if backend, err = openPackBackend(s.rootDir); err != nil {
+			return
+		}
+	}
+
+	if err = s.backend.Close(); err != nil {
+		backend.Close()
+		return
+	}
+	backend.SetSync(!s.noSync)
+	s.backend = backend
+
+	return
 }
 
 func (s *ClientStore) String() string {
 	return fmt.Sprintf(
-		"{root:%q}",
+		"{root:%q, backend:%q}",
 		s.rootDir,
+		s.backend.Name(),
 	)
 }
 
@@ -127,101 +202,149 @@ func (s *ClientStore) Root() string {
 	return s.rootDir
 }
 
-func (s *ClientStore) ClientDirPath(id FileId) string {
-	return filepath.Join(s.rootDir, id.DirPath())
+func (s *ClientStore) Backend() string {
+	return s.backend.Name()
 }
 
-func (s *ClientStore) ClientPath(id FileId, fileType FileType) string {
-	return filepath.Join(s.rootDir, id.Path(fileType))
+// SetSync controls whether each client file write is synced to stable
+// storage before it returns, the default, or only when the ClientStore is
+// closed, which is much faster when writing many files that can be
+// regenerated if lost, e.g. when generating clients.
+func (s *ClientStore) SetSync(sync bool) {
+	s.noSync = !sync
+	s.backend.SetSync(sync)
 }
 
-func (s *ClientStore) EnsureDirectoryExists(id FileId) (err error) {
-	dirPath := s.ClientDirPath(id)
+// SetCompression controls whether client files are written gzip
+// compressed, when that reduces their size. Compressed files are detected
+// when read, regardless of this setting, so a datastore can hold a mix of
+// compressed and uncompressed files.
+func (s *ClientStore) SetCompression(compress bool) {
+	s.compress = compress
+}
 
-	// ensure directory hierarchy exists for file
-	if err = os.MkdirAll(dirPath, 0o755); err != nil {
-		err = fmt.Errorf(
-			"failed to create datastore file hierarchy %q: %w",
-			dirPath,
-			err,
-		)
-		return
+// Compression returns the compression used when writing client files, or
+// an empty string if they are written uncompressed.
+func (s *ClientStore) Compression() string {
+	if s.compress {
+		return COMPRESSION_GZIP
 	}
+	return ""
+}
+
+// WriteSizes returns the total sizes of the client files written by the
+// ClientStore, before and after any compression.
+func (s *ClientStore) WriteSizes() (logical, stored int64) {
+	return s.logicalBytes.Load(), s.storedBytes.Load()
+}
 
+// Close releases the resources held by the backend and the journal,
+// persisting any state needed to reopen the datastore efficiently, and
+// then releases any lock held on the datastore.
+func (s *ClientStore) Close() (err error) {
+	err = s.backend.Close()
+	if journalErr := s.journal.close(); err == nil {
+		err = journalErr
+	}
+	if unlockErr := s.Unlock(); err == nil {
+		err = unlockErr
+	}
 	return
 }
 
 func (s *ClientStore) WriteFile(id FileId, fileType FileType, data []byte, perm os.FileMode) (err error) {
-	if err = s.EnsureDirectoryExists(id); err != nil {
-		err = fmt.Errorf(
-			"failed to write datastore file: %w",
-			err,
-		)
+	stored := data
+	if s.compress {
+		var compressed []byte
+		if compressed, err = gzipData(data); err != nil {
+			err = fmt.Errorf(
+				"failed to compress datastore file %q: %w",
+				id.Path(fileType),
+				err,
+			)
+			return
+		}
+		if len(compressed) < len(data) {
+			stored = compressed
+		}
 	}
 
-	filePath := s.ClientPath(id, fileType)
-	if err = os.WriteFile(filePath, data, perm); err != nil {
-		err = fmt.Errorf(
-			"failed to write datastore file %q: %w",
-			filePath,
-			err,
-		)
-		// delete any partially created file, ignoring the error
-		_ = s.Delete(id, fileType)
+	if err = s.backend.WriteFile(id, fileType, stored, perm); err != nil {
 		return
 	}
+	s.logicalBytes.Add(int64(len(data)))
+	s.storedBytes.Add(int64(len(stored)))
 
 	return
 }
 
+// ReadFile returns the content of the client file, decompressing it if it
+// was stored compressed.
 func (s *ClientStore) ReadFile(id FileId, fileType FileType) (data []byte, err error) {
-	filePath := s.ClientPath(id, fileType)
-
-	if data, err = os.ReadFile(filePath); err != nil {
-		err = fmt.Errorf(
-			"failed to read datastore file %q: %w",
-			filePath,
-			err,
-		)
+	if data, err = s.backend.ReadFile(id, fileType); err != nil {
 		return
 	}
 
-	return
-}
-
-func (s *ClientStore) Delete(id FileId, fileType FileType) (err error) {
-	filePath := s.ClientPath(id, fileType)
-
-	err = os.Remove(filePath)
-	if err != nil {
-		err = fmt.Errorf(
-			"failed to delete datastore file %q: %w",
-			filePath,
-			err,
-		)
-		return
+	if isGzipped(data) {
+		if data, err = gunzipData(data); err != nil {
+			err = fmt.Errorf(
+				"failed to decompress datastore file %q: %w",
+				id.Path(fileType),
+				err,
+			)
+			data = nil
+			return
+		}
 	}
 
 	return
 }
 
+func (s *ClientStore) Delete(id FileId, fileType FileType) error {
+	return s.backend.Delete(id, fileType)
+}
+
 func (s *ClientStore) Exists(id FileId, fileType FileType) bool {
-	filePath := s.ClientPath(id, fileType)
+	return s.backend.Exists(id, fileType)
+}
 
-	st, err := os.Stat(filePath)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			// doesn't exist
-			return false
+// Walk calls fn for each client file in the datastore, in ascending id
+// order, stopping if fn returns an error.
+func (s *ClientStore) Walk(fn func(id FileId, fileType FileType) error) error {
+	return s.backend.Walk(fn)
+}
+
+// WalkFileIds calls fn with the id of each client that has a file of the
+// specified type in the datastore, in ascending id order, stopping if fn
+// returns an error.
+func (s *ClientStore) WalkFileIds(fileType FileType, fn func(id FileId) error) error {
+	return s.backend.Walk(func(id FileId, walkType FileType) error {
+		if walkType != fileType {
+			return nil
 		}
+		return fn(id)
+	})
+}
 
-		// some other error, possibly path access permissions
-		return false
-	}
-	if st.IsDir() {
-		// path does exist but is a directory, but doesn't matter for now
-		return true
+// Compact rewrites the datastore's client files, dropping the superseded
+// and deleted versions retained by pack backend datastores, returning the
+// size of the pack before and after.
+func (s *ClientStore) Compact() (before, after int64, err error) {
+	pack, ok := s.backend.(*packBackend)
+	if !ok {
+		err = fmt.Errorf(
+			"datastore %q uses the %s backend, which doesn't need compacting",
+			s.rootDir,
+			s.backend.Name(),
+		)
+		return
 	}
 
-	return true
+	return pack.Compact()
+}
+
+// MaxFileId returns the highest id that has a file of the specified type
+// in the datastore, with found being false if there are no such files.
+func (s *ClientStore) MaxFileId(fileType FileType) (id FileId, found bool, err error) {
+	return s.backend.MaxFileId(fileType)
 }
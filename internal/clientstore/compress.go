@@ -0,0 +1,52 @@
+package clientstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+const COMPRESSION_GZIP = "gzip"
+
+// gzip writers are reused as each allocates substantial compression state
+var gzipWriters = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// gzipMagic identifies gzip compressed data, which can't be confused with
+// the JSON or XML content of uncompressed client files.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func isGzipped(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+func gzipData(data []byte) (compressed []byte, err error) {
+	var buf bytes.Buffer
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+
+	w.Reset(&buf)
+	if _, err = w.Write(data); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+
+	compressed = buf.Bytes()
+	return
+}
+
+func gunzipData(compressed []byte) (data []byte, err error) {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
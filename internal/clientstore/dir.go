@@ -0,0 +1,277 @@
+package clientstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// dirBackend stores each client's files in a three level directory
+// hierarchy, derived from the client's id, under the datastore root.
+type dirBackend struct {
+	rootDir string
+	sync    bool
+}
+
+func newDirBackend(rootDir string) *dirBackend {
+	return &dirBackend{rootDir: rootDir, sync: true}
+}
+
+func (s *dirBackend) Name() string {
+	return BACKEND_DIR
+}
+
+func (s *dirBackend) SetSync(sync bool) {
+	s.sync = sync
+}
+
+// Close syncs the filesystem holding the datastore if the writes weren't
+// synced as they were made.
+func (s *dirBackend) Close() (err error) {
+	if s.sync {
+		return
+	}
+
+	d, err := os.Open(s.rootDir)
+	if err == nil {
+		err = unix.Syncfs(int(d.Fd()))
+		d.Close()
+	}
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to sync datastore %q: %w",
+			s.rootDir,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+func (s *dirBackend) ClientDirPath(id FileId) string {
+	return filepath.Join(s.rootDir, id.DirPath())
+}
+
+func (s *dirBackend) ClientPath(id FileId, fileType FileType) string {
+	return filepath.Join(s.rootDir, id.Path(fileType))
+}
+
+func (s *dirBackend) EnsureDirectoryExists(id FileId) (err error) {
+	dirPath := s.ClientDirPath(id)
+
+	// ensure directory hierarchy exists for file
+	if err = os.MkdirAll(dirPath, 0o755); err != nil {
+		err = fmt.Errorf(
+			"failed to create datastore file hierarchy %q: %w",
+			dirPath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// WriteFile atomically replaces the client's file, so that an interrupted
+// write leaves the previous version of the file intact.
+func (s *dirBackend) WriteFile(id FileId, fileType FileType, data []byte, perm os.FileMode) (err error) {
+	if err = s.EnsureDirectoryExists(id); err != nil {
+		err = fmt.Errorf(
+			"failed to write datastore file: %w",
+			err,
+		)
+		return
+	}
+
+	filePath := s.ClientPath(id, fileType)
+	if err = writeFileAtomic(filePath, data, perm, s.sync); err != nil {
+		err = fmt.Errorf(
+			"failed to write datastore file %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+func (s *dirBackend) ReadFile(id FileId, fileType FileType) (data []byte, err error) {
+	filePath := s.ClientPath(id, fileType)
+
+	if data, err = os.ReadFile(filePath); err != nil {
+		err = fmt.Errorf(
+			"failed to read datastore file %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+func (s *dirBackend) Delete(id FileId, fileType FileType) (err error) {
+	filePath := s.ClientPath(id, fileType)
+
+	err = os.Remove(filePath)
+	if err == nil && s.sync {
+		err = syncDir(s.ClientDirPath(id))
+	}
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to delete datastore file %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+func (s *dirBackend) Exists(id FileId, fileType FileType) bool {
+	filePath := s.ClientPath(id, fileType)
+
+	st, err := os.Stat(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// doesn't exist
+			return false
+		}
+
+		// some other error, possibly path access permissions
+		return false
+	}
+	if st.IsDir() {
+		// path does exist but is a directory, but doesn't matter for now
+		return true
+	}
+
+	return true
+}
+
+// sorted, highest first, values of the 3 hex digit id directories in dirPath
+func idDirValues(dirPath string) (values []uint32, err error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to read datastore directory %q: %w",
+			dirPath,
+			err,
+		)
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || len(entry.Name()) != 3 {
+			continue
+		}
+		value, convErr := strconv.ParseUint(entry.Name(), 16, 32)
+		if convErr != nil {
+			continue
+		}
+		values = append(values, uint32(value))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] > values[j] })
+
+	return
+}
+
+func (s *dirBackend) MaxFileId(fileType FileType) (id FileId, found bool, err error) {
+	tops, err := idDirValues(s.rootDir)
+	if err != nil {
+		return
+	}
+	for _, top := range tops {
+		topPath := filepath.Join(s.rootDir, fmt.Sprintf("%03x", top))
+		var mids []uint32
+		if mids, err = idDirValues(topPath); err != nil {
+			return
+		}
+		for _, mid := range mids {
+			midPath := filepath.Join(topPath, fmt.Sprintf("%03x", mid))
+			var leaves []uint32
+			if leaves, err = idDirValues(midPath); err != nil {
+				return
+			}
+			for _, leaf := range leaves {
+				candidate := FileId(top<<20 | mid<<10 | leaf)
+				if s.Exists(candidate, fileType) {
+					id, found = candidate, true
+					return
+				}
+			}
+		}
+	}
+
+	return
+}
+
+func (s *dirBackend) Walk(fn func(id FileId, fileType FileType) error) (err error) {
+	tops, err := idDirValues(s.rootDir)
+	if err != nil {
+		return
+	}
+	slices.Reverse(tops)
+	for _, top := range tops {
+		topPath := filepath.Join(s.rootDir, fmt.Sprintf("%03x", top))
+		var mids []uint32
+		if mids, err = idDirValues(topPath); err != nil {
+			return
+		}
+		slices.Reverse(mids)
+		for _, mid := range mids {
+			midPath := filepath.Join(topPath, fmt.Sprintf("%03x", mid))
+			var leaves []uint32
+			if leaves, err = idDirValues(midPath); err != nil {
+				return
+			}
+			slices.Reverse(leaves)
+			for _, leaf := range leaves {
+				id := FileId(top<<20 | mid<<10 | leaf)
+				if err = s.walkClient(id, fn); err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// walkClient calls fn for each of the client's files, in name order.
+func (s *dirBackend) walkClient(id FileId, fn func(id FileId, fileType FileType) error) (err error) {
+	dirPath := s.ClientDirPath(id)
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to read datastore directory %q: %w",
+			dirPath,
+			err,
+		)
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		fileType, ok := fileTypeOf(entry.Name())
+		if !ok {
+			continue
+		}
+		if err = fn(id, fileType); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,223 @@
+package clientstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const JOURNAL_FILE = "journal.jsonl"
+
+// RegState is a client registration state recorded in the journal.
+type RegState string
+
+const (
+	REG_STATE_REGISTERING   RegState = "registering"
+	REG_STATE_REGISTERED    RegState = "registered"
+	REG_STATE_DEREGISTERING RegState = "deregistering"
+	REG_STATE_UNREGISTERED  RegState = "unregistered"
+)
+
+// JournalEntry records a client's transition to a registration state, with
+// the data of registered clients holding their registration information,
+// so that it can be restored if the client's files are lost.
+type JournalEntry struct {
+	Time  time.Time       `json:"time"`
+	Id    FileId          `json:"id"`
+	State RegState        `json:"state"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// journal is the append only JSON lines file recording the registration
+// state transitions of a datastore's clients, opened when the first entry
+// is appended.
+type journal struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func (j *journal) open(filePath string) (err error) {
+	j.file, err = os.OpenFile(filePath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return
+	}
+
+	// terminate any partial entry left by an interrupted append, so that
+	// it doesn't corrupt the next entry
+	fi, err := j.file.Stat()
+	if err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = j.file.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			_, err = j.file.Write([]byte{'\n'})
+		}
+	}
+	if err != nil {
+		j.file.Close()
+		j.file = nil
+		return
+	}
+
+	return
+}
+
+func (j *journal) append(filePath string, line []byte, sync bool) (err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		if err = j.open(filePath); err != nil {
+			return
+		}
+	}
+
+	// each entry is appended by a single write so entries can't interleave
+	if _, err = j.file.Write(line); err != nil {
+		return
+	}
+	if sync {
+		err = j.file.Sync()
+	}
+
+	return
+}
+
+func (j *journal) close() (err error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return
+	}
+
+	err = j.file.Sync()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	j.file = nil
+
+	return
+}
+
+func (s *ClientStore) JournalPath() string {
+	return filepath.Join(s.rootDir, JOURNAL_FILE)
+}
+
+// Journal appends an entry recording the client's transition to the
+// specified registration state, with data, if any, being the client's
+// registration information as JSON.
+func (s *ClientStore) Journal(id FileId, state RegState, data []byte) (err error) {
+	entry := JournalEntry{
+		Time:  time.Now().UTC(),
+		Id:    id,
+		State: state,
+		Data:  data,
+	}
+
+	line, err := json.Marshal(&entry)
+	if err == nil {
+		err = s.journal.append(s.JournalPath(), append(line, '\n'), !s.noSync)
+	}
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to journal client %d %s state in %q: %w",
+			id,
+			state,
+			s.JournalPath(),
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// ReadJournal returns the latest journal entry of each client that has
+// one, skipping any entries damaged by a crash.
+func (s *ClientStore) ReadJournal() (entries map[FileId]*JournalEntry, err error) {
+	filePath := s.JournalPath()
+	entries = make(map[FileId]*JournalEntry)
+
+	f, err := os.Open(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to open datastore journal %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+	defer f.Close()
+
+	damaged := 0
+	r := bufio.NewReader(f)
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			entry := new(JournalEntry)
+			if json.Unmarshal(line, entry) != nil || entry.State == "" {
+				damaged++
+			} else {
+				entries[entry.Id] = entry
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			err = fmt.Errorf(
+				"failed to read datastore journal %q: %w",
+				filePath,
+				readErr,
+			)
+			return
+		}
+	}
+
+	if damaged > 0 {
+		log.Printf(
+			"WARNING: Skipped %d damaged entries in datastore journal %q",
+			damaged,
+			filePath,
+		)
+	}
+
+	return
+}
+
+// CopyJournal atomically replaces the datastore's journal with a copy of
+// that of the src datastore, if it has one, e.g. when converting it, so
+// that the registration history of its clients is retained.
+func (s *ClientStore) CopyJournal(src *ClientStore) (err error) {
+	data, err := os.ReadFile(src.JournalPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err == nil {
+		err = writeFileAtomic(s.JournalPath(), data, 0o644, !s.noSync)
+	}
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to copy datastore journal %q to %q: %w",
+			src.JournalPath(),
+			s.JournalPath(),
+			err,
+		)
+		return
+	}
+
+	return
+}
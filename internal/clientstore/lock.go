@@ -0,0 +1,275 @@
+package clientstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const LOCK_FILE = "datastore.lock"
+
+// ErrLocked is returned, wrapped, when a datastore is locked by another
+// process.
+var ErrLocked = errors.New("datastore is locked")
+
+// LockMode is the mode of the advisory lock held on a datastore, with any
+// number of processes able to hold shared locks, e.g. to read the clients,
+// but only one process able to hold an exclusive lock, e.g. to modify them.
+type LockMode int
+
+const (
+	LOCK_SHARED LockMode = iota
+	LOCK_EXCLUSIVE
+)
+
+func (m LockMode) String() string {
+	if m == LOCK_EXCLUSIVE {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+// LockHolder describes a process holding a lock on a datastore, recorded
+// in a holder file alongside the lock file so that processes failing to
+// acquire the lock can report who holds it.
+type LockHolder struct {
+	Pid     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Mode    string    `json:"mode"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+func (h *LockHolder) String() string {
+	return fmt.Sprintf(
+		"%q, pid %d on host %q, holding it in %s mode since %s",
+		h.Command,
+		h.Pid,
+		h.Host,
+		h.Mode,
+		h.Since.Local().Format(time.DateTime),
+	)
+}
+
+// storeLock is the advisory lock held on a datastore.
+type storeLock struct {
+	file       *os.File
+	holderPath string
+}
+
+func (s *ClientStore) LockPath() string {
+	return filepath.Join(s.rootDir, LOCK_FILE)
+}
+
+// Lock acquires an advisory lock of the specified mode on the datastore,
+// which is released when the ClientStore is closed, or the process exits,
+// failing with an error wrapping ErrLocked, naming the holders, if another
+// process holds a conflicting lock. The command identifies the process to
+// those that fail to acquire the lock.
+func (s *ClientStore) Lock(mode LockMode, command string) (err error) {
+	if s.lock.file != nil {
+		err = fmt.Errorf(
+			"datastore %q is already locked by this process",
+			s.rootDir,
+		)
+		return
+	}
+
+	lockPath := s.LockPath()
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to open datastore lock %q: %w",
+			lockPath,
+			err,
+		)
+		return
+	}
+
+	how := unix.LOCK_SH
+	if mode == LOCK_EXCLUSIVE {
+		how = unix.LOCK_EX
+	}
+	if err = unix.Flock(int(f.Fd()), how|unix.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			err = fmt.Errorf(
+				"%w: %q is in use by %s",
+				ErrLocked,
+				s.rootDir,
+				s.describeHolders(),
+			)
+			return
+		}
+		err = fmt.Errorf(
+			"failed to lock datastore %q: %w",
+			s.rootDir,
+			err,
+		)
+		return
+	}
+
+	// holder files of processes that exited without unlocking are stale
+	s.removeStaleHolders(mode)
+
+	host, _ := os.Hostname()
+	holder := LockHolder{
+		Pid:     os.Getpid(),
+		Host:    host,
+		Mode:    mode.String(),
+		Command: command,
+		Since:   time.Now().UTC(),
+	}
+	holderPath := fmt.Sprintf("%s.%s-%d", lockPath, host, holder.Pid)
+	data, err := json.Marshal(&holder)
+	if err == nil {
+		err = writeFileAtomic(holderPath, data, 0o644, false)
+	}
+	if err != nil {
+		f.Close()
+		err = fmt.Errorf(
+			"failed to record datastore lock holder %q: %w",
+			holderPath,
+			err,
+		)
+		return
+	}
+
+	s.lock = storeLock{file: f, holderPath: holderPath}
+
+	return
+}
+
+// Unlock releases the datastore lock, if held.
+func (s *ClientStore) Unlock() (err error) {
+	if s.lock.file == nil {
+		return
+	}
+
+	_ = os.Remove(s.lock.holderPath)
+	if err = s.lock.file.Close(); err != nil {
+		err = fmt.Errorf(
+			"failed to unlock datastore %q: %w",
+			s.rootDir,
+			err,
+		)
+	}
+	s.lock = storeLock{}
+
+	return
+}
+
+// LockClients acquires exclusive advisory locks on the clients with the
+// specified ascending ids, as byte range locks of the lock file, allowing
+// processes holding shared datastore locks to act upon different clients
+// concurrently, failing with an error wrapping ErrLocked if any of them
+// are locked by another process.
+func (s *ClientStore) LockClients(ids []FileId) (err error) {
+	if s.lock.file == nil {
+		err = fmt.Errorf(
+			"datastore %q must be locked before its clients",
+			s.rootDir,
+		)
+		return
+	}
+
+	for start := 0; start < len(ids); {
+		// lock each run of consecutive ids as a single range
+		end := start + 1
+		for end < len(ids) && ids[end] == ids[end-1]+1 {
+			end++
+		}
+
+		lk := unix.Flock_t{
+			Type:   unix.F_WRLCK,
+			Whence: io.SeekStart,
+			Start:  int64(ids[start]),
+			Len:    int64(end - start),
+		}
+		if err = unix.FcntlFlock(s.lock.file.Fd(), unix.F_OFD_SETLK, &lk); err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EACCES) {
+				err = fmt.Errorf(
+					"%w: clients %d-%d of %q overlap those in use by %s",
+					ErrLocked,
+					ids[start],
+					ids[end-1],
+					s.rootDir,
+					s.describeHolders(),
+				)
+				return
+			}
+			err = fmt.Errorf(
+				"failed to lock clients %d-%d of datastore %q: %w",
+				ids[start],
+				ids[end-1],
+				s.rootDir,
+				err,
+			)
+			return
+		}
+
+		start = end
+	}
+
+	return
+}
+
+// readHolders returns the recorded lock holders, and their holder files,
+// removing those of processes on this host that no longer exist.
+func (s *ClientStore) readHolders() (holders []*LockHolder, paths []string) {
+	host, _ := os.Hostname()
+	matches, _ := filepath.Glob(s.LockPath() + ".*")
+	for _, holderPath := range matches {
+		data, err := os.ReadFile(holderPath)
+		if err != nil {
+			continue
+		}
+		holder := new(LockHolder)
+		if json.Unmarshal(data, holder) != nil {
+			continue
+		}
+		if holder.Host == host && errors.Is(unix.Kill(holder.Pid, 0), unix.ESRCH) {
+			_ = os.Remove(holderPath)
+			continue
+		}
+		holders = append(holders, holder)
+		paths = append(paths, holderPath)
+	}
+	return
+}
+
+// removeStaleHolders removes the holder files that can't belong to a
+// current holder given that a lock of the specified mode was acquired,
+// being all of them for an exclusive lock, or those of exclusive holders
+// for a shared lock.
+func (s *ClientStore) removeStaleHolders(mode LockMode) {
+	holders, paths := s.readHolders()
+	for i, holder := range holders {
+		if mode == LOCK_EXCLUSIVE || holder.Mode == LOCK_EXCLUSIVE.String() {
+			_ = os.Remove(paths[i])
+		}
+	}
+}
+
+// describeHolders describes the other processes holding the lock.
+func (s *ClientStore) describeHolders() string {
+	holders, paths := s.readHolders()
+
+	descriptions := []string{}
+	for i, holder := range holders {
+		if paths[i] != s.lock.holderPath {
+			descriptions = append(descriptions, holder.String())
+		}
+	}
+	if len(descriptions) == 0 {
+		return "another process"
+	}
+	return strings.Join(descriptions, "; ")
+}
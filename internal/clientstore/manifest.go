@@ -0,0 +1,285 @@
+package clientstore
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	MANIFEST_FILE = "manifest.json"
+
+	// version of the datastore layout and file formats, to be incremented
+	// when changes are made that older tools can't handle, with version 2
+	// adding the pack backend, and version 3 gzip compressed client files
+	MANIFEST_SCHEMA_VERSION = 3
+)
+
+// Manifest describes how the clients in a datastore were generated.
+type Manifest struct {
+	SchemaVersion    int            `json:"schemaVersion"`
+	Generator        string         `json:"generator"`
+	GeneratorVersion string         `json:"generatorVersion"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+	Seed             int64          `json:"seed"`
+	NumClients       int64          `json:"numClients"`
+	NextId           int64          `json:"nextId"` // one past the highest client id
+	ClientRanges     []ClientRange  `json:"clientRanges,omitempty"`
+	Runs             []GeneratorRun `json:"runs,omitempty"`
+	Backend          string         `json:"backend,omitempty"`
+	Compression      string         `json:"compression,omitempty"`
+	TypeMix          map[string]int `json:"typeMix"`
+	ProviderMix      map[string]int `json:"providerMix"`
+	ProductMix       map[string]int `json:"productMix,omitempty"`
+	PciFormatMix     map[string]int `json:"pciFormatMix"`
+	ProfileTypes     []string       `json:"profileTypes"`
+}
+
+// GeneratorRun records the seed and mixes used by each generator run that
+// created, or appended clients to, the datastore.
+type GeneratorRun struct {
+	Time         time.Time      `json:"time"`
+	Seed         int64          `json:"seed"`
+	StartId      int64          `json:"startId"`
+	NumClients   int64          `json:"numClients"`
+	TypeMix      map[string]int `json:"typeMix"`
+	ProviderMix  map[string]int `json:"providerMix"`
+	ProductMix   map[string]int `json:"productMix,omitempty"`
+	PciFormatMix map[string]int `json:"pciFormatMix"`
+}
+
+// CombinedMix returns the mix describing the existing clients, generated
+// using the existing mix, and the clients added using the added mix, which
+// is empty if they differ, as no single mix describes all of the clients.
+func CombinedMix(existing, added map[string]int) map[string]int {
+	if !maps.Equal(existing, added) {
+		return nil
+	}
+	return added
+}
+
+// AddRun records a generator run, with the manifest's seed and mixes being
+// those of the run, or, when appending clients, its mixes being combined
+// with those of the existing clients.
+func (m *Manifest) AddRun(run GeneratorRun) {
+	if len(m.Runs) == 0 && m.NumClients > 0 {
+		// manifests written before the runs were recorded describe the
+		// existing clients as if generated by a single run
+		m.Runs = append(m.Runs, GeneratorRun{
+			Time:         m.UpdatedAt,
+			Seed:         m.Seed,
+			NumClients:   m.NumClients,
+			TypeMix:      m.TypeMix,
+			ProviderMix:  m.ProviderMix,
+			ProductMix:   m.ProductMix,
+			PciFormatMix: m.PciFormatMix,
+		})
+	}
+
+	if len(m.Runs) == 0 {
+		m.TypeMix = run.TypeMix
+		m.ProviderMix = run.ProviderMix
+		m.ProductMix = run.ProductMix
+		m.PciFormatMix = run.PciFormatMix
+	} else {
+		m.TypeMix = CombinedMix(m.TypeMix, run.TypeMix)
+		m.ProviderMix = CombinedMix(m.ProviderMix, run.ProviderMix)
+		m.ProductMix = CombinedMix(m.ProductMix, run.ProductMix)
+		m.PciFormatMix = CombinedMix(m.PciFormatMix, run.PciFormatMix)
+	}
+	m.Seed = run.Seed
+	m.Runs = append(m.Runs, run)
+}
+
+// ClientRange is an inclusive range of the ids of generated clients.
+type ClientRange struct {
+	First FileId `json:"first"`
+	Last  FileId `json:"last"`
+}
+
+func (r ClientRange) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("%d", r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+func (s *ClientStore) ManifestPath() string {
+	return filepath.Join(s.rootDir, MANIFEST_FILE)
+}
+
+// ReadManifest loads the datastore's manifest, returning an error wrapping
+// os.ErrNotExist if the datastore doesn't have one.
+func (s *ClientStore) ReadManifest() (m *Manifest, err error) {
+	filePath := s.ManifestPath()
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to read datastore manifest %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+
+	m = new(Manifest)
+	if err = json.Unmarshal(data, m); err != nil {
+		err = fmt.Errorf(
+			"failed to json.Unmarshal() datastore manifest %q: %w",
+			filePath,
+			err,
+		)
+		m = nil
+		return
+	}
+
+	return
+}
+
+func (s *ClientStore) WriteManifest(m *Manifest) (err error) {
+	filePath := s.ManifestPath()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to json.Marshal() datastore manifest: %w",
+			err,
+		)
+		return
+	}
+
+	if err = writeFileAtomic(filePath, data, 0o644, true); err != nil {
+		err = fmt.Errorf(
+			"failed to write datastore manifest %q: %w",
+			filePath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// Validate checks that the datastore described by the manifest can be
+// handled by this version of the tools.
+func (m *Manifest) Validate() (err error) {
+	if m.SchemaVersion < 1 || m.SchemaVersion > MANIFEST_SCHEMA_VERSION {
+		err = fmt.Errorf(
+			"unsupported datastore schema version %d, only versions up to %d are supported",
+			m.SchemaVersion,
+			MANIFEST_SCHEMA_VERSION,
+		)
+		return
+	}
+
+	return
+}
+
+// BackendName returns the name of the backend storing the client files,
+// which is the dir backend for datastores created before it was recorded.
+func (m *Manifest) BackendName() string {
+	if m.Backend == "" {
+		return BACKEND_DIR
+	}
+	return m.Backend
+}
+
+// CheckBackend checks that the datastore's client files are stored using
+// the named backend.
+func (m *Manifest) CheckBackend(backendName string) (err error) {
+	if m.BackendName() != backendName {
+		err = fmt.Errorf(
+			"datastore uses the %q backend, not the %q backend",
+			m.BackendName(),
+			backendName,
+		)
+		return
+	}
+
+	return
+}
+
+// AddClients records the ranges of generated client ids, merging them with
+// the recorded ranges.
+func (m *Manifest) AddClients(ranges ...ClientRange) {
+	merged := append(slices.Clone(m.ClientRanges), ranges...)
+	slices.SortFunc(merged, func(a, b ClientRange) int {
+		return cmp.Compare(a.First, b.First)
+	})
+
+	m.ClientRanges = m.ClientRanges[:0]
+	for _, r := range merged {
+		n := len(m.ClientRanges)
+		if n > 0 && int64(r.First) <= int64(m.ClientRanges[n-1].Last)+1 {
+			m.ClientRanges[n-1].Last = max(m.ClientRanges[n-1].Last, r.Last)
+			continue
+		}
+		m.ClientRanges = append(m.ClientRanges, r)
+	}
+}
+
+// clientRanges describes the recorded ranges of generated client ids.
+func (m *Manifest) clientRanges() string {
+	ranges := make([]string, len(m.ClientRanges))
+	for i, r := range m.ClientRanges {
+		ranges[i] = r.String()
+	}
+	return strings.Join(ranges, ",")
+}
+
+// CheckClients checks that the datastore holds the specified number of
+// clients, with ids starting from 0.
+func (m *Manifest) CheckClients(numClients int64) (err error) {
+	if numClients == 0 {
+		return
+	}
+
+	if err = m.CheckIds(0, FileId(numClients-1)); err != nil {
+		err = fmt.Errorf(
+			"can't act upon %d clients: %w",
+			numClients,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// CheckIds checks that the datastore holds the clients with ids from first
+// to last, inclusive, falling back to checking that they are below the next
+// id for manifests that don't record the ranges of generated client ids.
+func (m *Manifest) CheckIds(first, last FileId) (err error) {
+	if len(m.ClientRanges) == 0 {
+		if int64(last) >= m.NextId {
+			err = fmt.Errorf(
+				"datastore holds %d clients, with ids below %d, not client %d",
+				m.NumClients,
+				m.NextId,
+				last,
+			)
+		}
+		return
+	}
+
+	for _, r := range m.ClientRanges {
+		if r.First <= first && last <= r.Last {
+			return
+		}
+	}
+
+	err = fmt.Errorf(
+		"datastore holds clients %s, not all of clients %s",
+		m.clientRanges(),
+		ClientRange{first, last},
+	)
+	return
+}
@@ -0,0 +1,514 @@
+package clientstore
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const (
+	PACK_FILE       = "clients.pack"
+	PACK_INDEX_FILE = "clients.idx"
+)
+
+// The pack is a sequence of records, each holding a client file, or a
+// tombstone marking its deletion, with later records superseding earlier
+// ones for the same file. A record consists of a header, holding little
+// endian integers, followed by the file type and data:
+//
+//	magic   uint32
+//	id      uint32
+//	length  uint32, of the data
+//	flags   uint8
+//	typeLen uint8, of the file type
+const (
+	packRecordMagic uint32 = 0x50544d52 // "RMTP"
+	packHeaderSize         = 14
+	packFlagDeleted uint8  = 1
+)
+
+type packKey struct {
+	Id   FileId
+	Type FileType
+}
+
+type packEntry struct {
+	Offset int64 // of the file data in the pack
+	Length uint32
+}
+
+// packIndex is the snapshot of the index saved when the pack is closed,
+// covering the records up to PackSize, so that only records appended
+// after it was saved need to be scanned when the pack is opened.
+type packIndex struct {
+	PackSize int64
+	Entries  map[packKey]packEntry
+}
+
+// packBackend stores all of the client files in a single append only pack
+// file, with an in memory index providing random access to them by id.
+type packBackend struct {
+	mutex     sync.RWMutex
+	packPath  string
+	indexPath string
+	file      *os.File
+	size      int64
+	entries   map[packKey]packEntry
+	sync      bool
+}
+
+func openPackBackend(rootDir string) (p *packBackend, err error) {
+	p = &packBackend{
+		packPath:  filepath.Join(rootDir, PACK_FILE),
+		indexPath: filepath.Join(rootDir, PACK_INDEX_FILE),
+		entries:   make(map[packKey]packEntry),
+		sync:      true,
+	}
+
+	p.file, err = os.OpenFile(p.packPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to open datastore pack %q: %w",
+			p.packPath,
+			err,
+		)
+		p = nil
+		return
+	}
+
+	fi, err := p.file.Stat()
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to stat datastore pack %q: %w",
+			p.packPath,
+			err,
+		)
+		p.file.Close()
+		p = nil
+		return
+	}
+
+	// use the saved index if it is usable, otherwise scan the whole pack
+	if index, indexErr := p.loadIndex(); indexErr == nil && index.PackSize <= fi.Size() {
+		p.entries = index.Entries
+		p.size = index.PackSize
+	}
+
+	if err = p.scan(fi.Size()); err != nil {
+		p.file.Close()
+		p = nil
+		return
+	}
+
+	return
+}
+
+func (p *packBackend) loadIndex() (index *packIndex, err error) {
+	f, err := os.Open(p.indexPath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	index = new(packIndex)
+	if err = gob.NewDecoder(bufio.NewReader(f)).Decode(index); err != nil {
+		index = nil
+		return
+	}
+	if index.Entries == nil {
+		index.Entries = make(map[packKey]packEntry)
+	}
+
+	return
+}
+
+// saveIndex atomically replaces the saved index, syncing it to stable
+// storage.
+func (p *packBackend) saveIndex() (err error) {
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(&packIndex{PackSize: p.size, Entries: p.entries})
+	if err == nil {
+		err = writeFileAtomic(p.indexPath, buf.Bytes(), 0o644, true)
+	}
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to save datastore pack index %q: %w",
+			p.indexPath,
+			err,
+		)
+		return
+	}
+
+	return
+}
+
+// scan applies the records from the end of the indexed records up to end,
+// truncating any incomplete record left by an interrupted write.
+func (p *packBackend) scan(end int64) (err error) {
+	r := bufio.NewReaderSize(io.NewSectionReader(p.file, p.size, end-p.size), 1<<20)
+	offset := p.size
+
+	for offset < end {
+		var header [packHeaderSize]byte
+		if _, readErr := io.ReadFull(r, header[:]); readErr != nil {
+			break
+		}
+		if binary.LittleEndian.Uint32(header[0:]) != packRecordMagic {
+			break
+		}
+		id := FileId(binary.LittleEndian.Uint32(header[4:]))
+		length := binary.LittleEndian.Uint32(header[8:])
+		flags := header[12]
+		typeBytes := make([]byte, header[13])
+		if _, readErr := io.ReadFull(r, typeBytes); readErr != nil {
+			break
+		}
+
+		dataOffset := offset + packHeaderSize + int64(len(typeBytes))
+		if dataOffset+int64(length) > end {
+			break
+		}
+		if _, discardErr := r.Discard(int(length)); discardErr != nil {
+			break
+		}
+
+		key := packKey{Id: id, Type: FileType(typeBytes)}
+		if flags&packFlagDeleted != 0 {
+			delete(p.entries, key)
+		} else {
+			p.entries[key] = packEntry{Offset: dataOffset, Length: length}
+		}
+		offset = dataOffset + int64(length)
+	}
+
+	if offset < end {
+		log.Printf(
+			"WARNING: Discarding %d bytes of incomplete records at the end of datastore pack %q",
+			end-offset,
+			p.packPath,
+		)
+		if err = p.file.Truncate(offset); err != nil {
+			err = fmt.Errorf(
+				"failed to truncate datastore pack %q: %w",
+				p.packPath,
+				err,
+			)
+			return
+		}
+	}
+	p.size = offset
+
+	return
+}
+
+// encodeRecord returns the pack record holding the file data.
+func encodeRecord(id FileId, fileType FileType, data []byte, flags uint8) (record []byte, err error) {
+	if len(fileType) > 255 {
+		err = fmt.Errorf(
+			"datastore file type %q is too long",
+			fileType,
+		)
+		return
+	}
+
+	record = make([]byte, packHeaderSize, packHeaderSize+len(fileType)+len(data))
+	binary.LittleEndian.PutUint32(record[0:], packRecordMagic)
+	binary.LittleEndian.PutUint32(record[4:], uint32(id))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(data)))
+	record[12] = flags
+	record[13] = uint8(len(fileType))
+	record = append(record, fileType...)
+	record = append(record, data...)
+
+	return
+}
+
+// appendRecord appends a record to the pack, returning the offset of its
+// data, with the caller holding the write lock.
+func (p *packBackend) appendRecord(id FileId, fileType FileType, data []byte, flags uint8) (dataOffset int64, err error) {
+	record, err := encodeRecord(id, fileType, data, flags)
+	if err != nil {
+		return
+	}
+
+	// a failed write is overwritten by the next record
+	if _, err = p.file.WriteAt(record, p.size); err != nil {
+		return
+	}
+	if p.sync {
+		if err = p.file.Sync(); err != nil {
+			return
+		}
+	}
+
+	dataOffset = p.size + packHeaderSize + int64(len(fileType))
+	p.size += int64(len(record))
+
+	return
+}
+
+func (p *packBackend) Name() string {
+	return BACKEND_PACK
+}
+
+func (p *packBackend) SetSync(sync bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.sync = sync
+}
+
+// WriteFile adds the file to the pack, superseding any previous version,
+// ignoring perm as packed files have no permissions of their own.
+func (p *packBackend) WriteFile(id FileId, fileType FileType, data []byte, perm os.FileMode) (err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	dataOffset, err := p.appendRecord(id, fileType, data, 0)
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to write datastore file %q to pack %q: %w",
+			id.Path(fileType),
+			p.packPath,
+			err,
+		)
+		return
+	}
+	p.entries[packKey{Id: id, Type: fileType}] = packEntry{Offset: dataOffset, Length: uint32(len(data))}
+
+	return
+}
+
+func (p *packBackend) ReadFile(id FileId, fileType FileType) (data []byte, err error) {
+	// the lock is held while reading, as compacting the pack replaces the
+	// file and moves the records
+	p.mutex.RLock()
+	entry, found := p.entries[packKey{Id: id, Type: fileType}]
+	if !found {
+		err = fs.ErrNotExist
+	} else {
+		data = make([]byte, entry.Length)
+		_, err = p.file.ReadAt(data, entry.Offset)
+	}
+	p.mutex.RUnlock()
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to read datastore file %q from pack %q: %w",
+			id.Path(fileType),
+			p.packPath,
+			err,
+		)
+		data = nil
+		return
+	}
+
+	return
+}
+
+func (p *packBackend) Delete(id FileId, fileType FileType) (err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := packKey{Id: id, Type: fileType}
+	if _, found := p.entries[key]; !found {
+		err = fs.ErrNotExist
+	} else {
+		_, err = p.appendRecord(id, fileType, nil, packFlagDeleted)
+	}
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to delete datastore file %q from pack %q: %w",
+			id.Path(fileType),
+			p.packPath,
+			err,
+		)
+		return
+	}
+	delete(p.entries, key)
+
+	return
+}
+
+func (p *packBackend) Exists(id FileId, fileType FileType) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	_, found := p.entries[packKey{Id: id, Type: fileType}]
+	return found
+}
+
+func (p *packBackend) MaxFileId(fileType FileType) (id FileId, found bool, err error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for key := range p.entries {
+		if key.Type == fileType && (!found || key.Id > id) {
+			id, found = key.Id, true
+		}
+	}
+
+	return
+}
+
+// sortedKeys returns the keys of the files in the pack, in ascending id
+// order, with the caller holding the lock.
+func (p *packBackend) sortedKeys() []packKey {
+	keys := make([]packKey, 0, len(p.entries))
+	for key := range p.entries {
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(a, b packKey) int {
+		return cmp.Or(cmp.Compare(a.Id, b.Id), cmp.Compare(a.Type, b.Type))
+	})
+	return keys
+}
+
+func (p *packBackend) Walk(fn func(id FileId, fileType FileType) error) (err error) {
+	p.mutex.RLock()
+	keys := p.sortedKeys()
+	p.mutex.RUnlock()
+
+	for _, key := range keys {
+		if err = fn(key.Id, key.Type); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Compact replaces the pack with one holding only the current version of
+// each file, in ascending id order, dropping the superseded versions and
+// deletion records that accumulate as files are rewritten and deleted,
+// returning the size of the pack before and after.
+func (p *packBackend) Compact() (before, after int64, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	before = p.size
+	dirPath := filepath.Dir(p.packPath)
+
+	// temporary files are hidden so that they are skipped by walks
+	f, err := os.CreateTemp(dirPath, "."+PACK_FILE+".tmp*")
+	if err != nil {
+		err = fmt.Errorf(
+			"failed to create compacted datastore pack in %q: %w",
+			dirPath,
+			err,
+		)
+		return
+	}
+	tmpPath := f.Name()
+
+	entries := make(map[packKey]packEntry, len(p.entries))
+	size := int64(0)
+	w := bufio.NewWriterSize(f, 1<<20)
+	for _, key := range p.sortedKeys() {
+		entry := p.entries[key]
+		data := make([]byte, entry.Length)
+		if _, err = p.file.ReadAt(data, entry.Offset); err != nil {
+			break
+		}
+
+		var record []byte
+		if record, err = encodeRecord(key.Id, key.Type, data, 0); err != nil {
+			break
+		}
+		if _, err = w.Write(record); err != nil {
+			break
+		}
+
+		entries[key] = packEntry{Offset: size + int64(len(record)-len(data)), Length: entry.Length}
+		size += int64(len(record))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+
+	// the saved index doesn't describe the compacted pack, so is removed
+	// before the pack is replaced, leaving the pack to be scanned when it
+	// is reopened if the compaction is interrupted
+	if err == nil {
+		if err = os.Remove(p.indexPath); errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = syncDir(dirPath)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, p.packPath)
+	}
+	if err != nil {
+		f.Close()
+		_ = os.Remove(tmpPath)
+		err = fmt.Errorf(
+			"failed to compact datastore pack %q: %w",
+			p.packPath,
+			err,
+		)
+		return
+	}
+
+	p.file.Close()
+	p.file = f
+	p.size = size
+	p.entries = entries
+	after = size
+
+	if err = syncDir(dirPath); err == nil {
+		err = p.saveIndex()
+	}
+
+	return
+}
+
+// Close syncs the pack and saves the index, so that the pack can be
+// reopened without being scanned, and closes the pack.
+func (p *packBackend) Close() (err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.file == nil {
+		return
+	}
+
+	// the index must not cover records that may not have reached storage
+	if err = p.file.Sync(); err != nil {
+		err = fmt.Errorf(
+			"failed to sync datastore pack %q: %w",
+			p.packPath,
+			err,
+		)
+	} else {
+		err = p.saveIndex()
+	}
+	if closeErr := p.file.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf(
+			"failed to close datastore pack %q: %w",
+			p.packPath,
+			closeErr,
+		)
+	}
+	p.file = nil
+
+	return
+}
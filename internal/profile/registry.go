@@ -0,0 +1,39 @@
+package profile
+
+import (
+	"slices"
+)
+
+// Known data profile types
+const (
+	PCI_DATA = "pci_data" // lspci output
+	MOD_LIST = "mod_list" // lsmod module names
+	DMI_DATA = "dmi_data" // DMI system identification summary
+	BLK_DATA = "blk_data" // lsblk block device layout
+)
+
+// registered profile types, in registration order
+var profileTypes = []string{
+	PCI_DATA,
+	MOD_LIST,
+	DMI_DATA,
+	BLK_DATA,
+}
+
+// Register adds a profile type to the set of known profile types, which
+// will be treated as data profiles when found in a client's system info.
+func Register(name string) {
+	if !IsRegistered(name) {
+		profileTypes = append(profileTypes, name)
+	}
+}
+
+// IsRegistered returns true if the named profile type is known.
+func IsRegistered(name string) bool {
+	return slices.Contains(profileTypes, name)
+}
+
+// Types returns the known profile types, in registration order.
+func Types() []string {
+	return slices.Clone(profileTypes)
+}